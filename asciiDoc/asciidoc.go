@@ -1,21 +1,31 @@
 package asciiDoc
 
 import (
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/clayts/docscii/file"
 	"github.com/clayts/docscii/xmlTree"
 )
 
 type Doc struct {
-	Keywords  map[string]struct{}
-	Entities  map[string]string
-	Data      map[string]string
-	Resources map[string]string
-	Metadata  xmlTree.Chunks
+	Keywords   map[string]struct{}
+	Entities   map[string]string
+	Data       map[string]string
+	Resources  map[string]string
+	Metadata   xmlTree.Chunks
+	Docinfo    []string
+	Attributes map[string]string
+	Books      map[string]*Doc
+	// Segments holds the AsciiDoc each numbered message was translated to.
+	Segments map[string]string
+	// Unknown counts the elements and processing instructions, by kind, that
+	// could not be translated.
+	Unknown map[string]int
 }
 
 func (d *Doc) Create(title, data string) string {
@@ -48,61 +58,193 @@ func New() *Doc {
 	d.Entities["blank"] = ""
 	d.Data = make(map[string]string)
 	d.Resources = make(map[string]string)
+	d.Docinfo = []string{"xml"}
+	d.Attributes = make(map[string]string)
+	d.Attributes["doctype"] = "book"
+	d.Books = make(map[string]*Doc)
+	d.Segments = make(map[string]string)
+	d.Unknown = make(map[string]int)
 	return d
 }
 
+// Jobs is how many resources are copied at once.
+var Jobs = 1
+
+// copyResources copies the images and other files the document refers to
+// into dir, Jobs at a time.
+func (d Doc) copyResources(dir string) {
+	var dsts []string
+	for dst := range d.Resources {
+		dsts = append(dsts, dst)
+	}
+	sort.Strings(dsts)
+	slots := make(chan struct{}, Jobs)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var panicked interface{}
+	for _, dst := range dsts {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(src, dst string) {
+			defer func() {
+				if r := recover(); r != nil {
+					mu.Lock()
+					if panicked == nil {
+						panicked = r
+					}
+					mu.Unlock()
+				}
+				<-slots
+				wg.Done()
+			}()
+			file.Copy(src, dst)
+		}(d.Resources[dst], dir+"/"+dst)
+	}
+	wg.Wait()
+	if panicked != nil {
+		// as if the copy had been made here
+		panic(panicked)
+	}
+}
+
 func (d Doc) Write(dir string) {
 	if d.Data["master.adoc"] == "" {
 		return
 	}
 
-	for dst, src := range d.Resources {
-		file.Copy(src, dir+"/"+dst)
+	for sub, b := range d.Books {
+		b.Write(dir + "/" + sub)
 	}
 
+	d.copyResources(dir)
+
+	var docinfo bool
+	// the docinfo refers to entities as attributes, which master.adoc defines
+	var docinfoText string
 	if len(d.Metadata) > 0 {
-		var ms []string
-		for _, m := range d.Metadata {
-			ms = append(ms, m.XML())
+		for _, f := range d.Docinfo {
+			switch f {
+			case "xml":
+				x := d.XMLDocinfo()
+				file.Write(dir+"/master-docinfo.xml", x)
+				docinfoText += x
+				docinfo = true
+			case "html":
+				h := d.HTMLDocinfo()
+				file.Write(dir+"/master-docinfo.html", h)
+				docinfoText += h
+				docinfo = true
+			}
 		}
-		sort.Strings(ms)
-		file.Write(dir+"/master-docinfo.xml", strings.Join(ms, "\n"))
 	}
 
 	if len(d.Entities) > 0 {
-		var es []string
-		for k, v := range d.Entities {
-			if k != "" && v != "" {
-				es = append(es, "\n:"+k+": "+v)
-			}
+		file.Write(dir+"/entities.adoc", d.entities())
+	}
+
+	d.Data["master.adoc"] = d.header(docinfo) + d.Data["master.adoc"]
+	for f, datum := range d.Data {
+		entFile := filepath.Dir(f)
+		entFile, _ = filepath.Rel(entFile, ".")
+		entFile = filepath.Clean(entFile + "/entities.adoc")
+		prefix := "\n:experimental:\n"
+		if d.usesEntities(datum) || f == "master.adoc" && d.usesEntities(docinfoText) {
+			prefix += "include::" + entFile + "[]\n"
+		}
+		prefix += "\n"
+		file.Write(dir+"/"+f, prefix+datum)
+	}
+}
+
+// entities returns the attribute entries defining d's entities.
+func (d Doc) entities() string {
+	var es []string
+	for k, v := range d.Entities {
+		if k != "" && v != "" {
+			es = append(es, "\n:"+k+": "+v)
 		}
-		sort.Strings(es)
-		ents := strings.Join(es, "\n")
-		file.Write(dir+"/entities.adoc", ents)
 	}
+	sort.Strings(es)
+	return strings.Join(es, "\n")
+}
 
+// header returns the attribute entries heading the master file.
+func (d Doc) header(docinfo bool) string {
+	attributes := make(map[string]string)
+	for k, v := range d.Attributes {
+		attributes[k] = v
+	}
+	if docinfo {
+		attributes["docinfo"] = "private"
+	}
+	var as []string
+	for k, v := range attributes {
+		as = append(as, ":"+k+": "+v+"\n")
+	}
+	sort.Strings(as)
+	var keywords string
 	if len(d.Keywords) > 0 {
 		var ks []string
 		for k := range d.Keywords {
 			ks = append(ks, k)
 		}
 		sort.Strings(ks)
-		d.Data["master.adoc"] = ":keywords: " + strings.Join(ks, ", ") + "\n\n" + d.Data["master.adoc"]
+		keywords = ":keywords: " + strings.Join(ks, ", ") + "\n\n"
 	}
+	return strings.Join(as, "") + keywords
+}
 
-	d.Data["master.adoc"] = ":doctype: book\n" + d.Data["master.adoc"]
-	for f, datum := range d.Data {
-		entFile := filepath.Dir(f)
-		entFile, _ = filepath.Rel(entFile, ".")
-		entFile = filepath.Clean(entFile + "/entities.adoc")
-		prefix := "\n:experimental:\n"
-		for k := range d.Entities {
-			if strings.Contains(datum, "{"+k+"}") {
-				prefix += "include::" + entFile + "[]\n"
-				break
+// Single returns the document as one file, for when there is nowhere to put
+// the rest: the files master.adoc includes are included in-line, as are the
+// text files copied as resources, and the entities are defined at the top.
+// Images, docinfo and the books of a set are left out.
+func (d Doc) Single() string {
+	if d.Data["master.adoc"] == "" {
+		return ""
+	}
+	prefix := "\n:experimental:\n"
+	for _, datum := range d.Data {
+		if d.usesEntities(datum) {
+			prefix += d.entities() + "\n"
+			break
+		}
+	}
+	return prefix + "\n" + d.header(false) + d.inline("master.adoc", make(map[string]bool))
+}
+
+// inline returns the file f with the files it includes in place of their
+// include lines. seen guards against a file including itself.
+func (d Doc) inline(f string, seen map[string]bool) string {
+	seen[f] = true
+	defer delete(seen, f)
+	lines := strings.Split(d.Data[f], "\n")
+	for i, l := range lines {
+		if !strings.HasPrefix(l, "include::") || !strings.HasSuffix(l, "]") {
+			continue
+		}
+		target := l[len("include::"):strings.LastIndex(l, "[")]
+		target = path.Join(path.Dir(f), target)
+		if _, ok := d.Data[target]; ok && !seen[target] {
+			lines[i] = d.inline(target, seen)
+		} else if src, ok := d.Resources[target]; ok {
+			lines[i] = strings.TrimSuffix(file.Read(src), "\n")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// usesEntities reports whether s refers to any of d's entities.
+func (d *Doc) usesEntities(s string) bool {
+	for {
+		i := strings.IndexByte(s, '{')
+		if i < 0 {
+			return false
+		}
+		s = s[i+1:]
+		if end := strings.IndexAny(s, "{}\n"); end > -1 && s[end] == '}' {
+			if _, ok := d.Entities[s[:end]]; ok {
+				return true
 			}
 		}
-		prefix += "\n"
-		file.Write(dir+"/"+f, prefix+datum)
 	}
 }
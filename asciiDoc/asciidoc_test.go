@@ -0,0 +1,74 @@
+package asciiDoc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clayts/docscii/xmlTree"
+)
+
+func TestSingle(t *testing.T) {
+	code := filepath.Join(t.TempDir(), "code.py")
+	if err := ioutil.WriteFile(code, []byte("print(1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		data      map[string]string
+		resources map[string]string
+		want      string
+	}{
+		{
+			name: "nothing to write",
+			data: map[string]string{"Chapter.adoc": "== Chapter"},
+			want: "",
+		},
+		{
+			name: "no entities used",
+			data: map[string]string{"master.adoc": "= Title\n\ninclude::Chapter.adoc[]", "Chapter.adoc": "== Chapter"},
+			want: "\n:experimental:\n\n:doctype: book\n= Title\n\n== Chapter",
+		},
+		{
+			name: "nested includes",
+			data: map[string]string{
+				"master.adoc":      "= Title\n\ninclude::Chapter.adoc[]\n\ninclude::missing.adoc[]",
+				"Chapter.adoc":     "== Chapter {PRODUCT}\n\ninclude::sub/Section.adoc[leveloffset=+1]",
+				"sub/Section.adoc": "=== Section\n\ninclude::../Chapter.adoc[]\n\ninclude::code.py[]",
+			},
+			resources: map[string]string{"sub/code.py": code},
+			want: "\n:experimental:\n\n:PRODUCT: Docscii\n\n:nbsp:  \n\n:doctype: book\n= Title\n\n" +
+				"== Chapter {PRODUCT}\n\n=== Section\n\ninclude::../Chapter.adoc[]\n\nprint(1)\n\ninclude::missing.adoc[]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New()
+			d.Entities["PRODUCT"] = "Docscii"
+			d.Data = tt.data
+			if tt.resources != nil {
+				d.Resources = tt.resources
+			}
+			if got := d.Single(); got != tt.want {
+				t.Errorf("Single() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteDocinfoEntities(t *testing.T) {
+	for name, want := range map[string]bool{"&PRODUCT;": true, "Docscii": false} {
+		dir := t.TempDir()
+		d := New()
+		d.Entities["PRODUCT"] = "Docscii"
+		d.Docinfo = []string{"xml", "html"}
+		d.Data["master.adoc"] = "= Title"
+		d.Metadata = xmlTree.New("<productname>" + name + "</productname>")
+		d.Write(dir)
+		master, _ := ioutil.ReadFile(filepath.Join(dir, "master.adoc"))
+		if got := strings.Contains(string(master), "include::entities.adoc[]"); got != want {
+			t.Errorf("productname %s: master.adoc includes entities.adoc = %v, want %v:\n%s", name, got, want, master)
+		}
+	}
+}
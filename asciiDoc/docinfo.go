@@ -0,0 +1,132 @@
+package asciiDoc
+
+import (
+	"html"
+	"strings"
+
+	"github.com/clayts/docscii/xmlTree"
+)
+
+// docinfoOrder is the order in which DocBook 5 expects info children.
+var docinfoOrder = []string{"productname", "productnumber", "edition", "pubsnumber", "subtitle", "abstract", "authorgroup", "legalnotice", "revhistory"}
+
+// docBook5Names maps DocBook 4 element names to their DocBook 5 equivalents.
+var docBook5Names = map[string]string{
+	"ulink":   "link",
+	"sgmltag": "tag",
+}
+
+// docBook5Attributes maps DocBook 4 attribute names to their DocBook 5 equivalents.
+var docBook5Attributes = map[string]string{
+	"id":   "xml:id",
+	"lang": "xml:lang",
+	"url":  "xlink:href",
+}
+
+var docBook5Namespaces = map[string]string{
+	"xlink": "http://www.w3.org/1999/xlink",
+}
+
+func (d Doc) sortedMetadata() xmlTree.Chunks {
+	var output xmlTree.Chunks
+	for _, kind := range docinfoOrder {
+		output = append(output, d.Metadata.Filter(kind)...)
+	}
+	return output
+}
+
+// XMLDocinfo returns the metadata as DocBook 5 info content, suitable for
+// Asciidoctor's DocBook backend.
+func (d Doc) XMLDocinfo() string {
+	var ms xmlTree.Chunks
+	for _, m := range d.sortedMetadata() {
+		if n := d.docBook5(m); n != nil {
+			ms = append(ms, n)
+		}
+	}
+	return ms.XMLWith(xmlTree.XMLOptions{Indent: "\t", Namespaces: docBook5Namespaces}) + "\n"
+}
+
+// HTMLDocinfo returns the metadata as HTML head content.
+func (d Doc) HTMLDocinfo() string {
+	var output string
+	for _, m := range d.sortedMetadata() {
+		switch m.Kind {
+		case "productname", "productnumber", "edition", "pubsnumber", "subtitle":
+			output += "<meta name=\"" + m.Kind + "\" content=\"" + d.docinfoText(m.Children.Flatten().Filter("TEXT"), true) + "\">\n"
+		case "abstract":
+			output += "<meta name=\"description\" content=\"" + d.docinfoText(m.Children.Flatten().Filter("TEXT"), true) + "\">\n"
+		}
+	}
+	return output
+}
+
+// docinfoText renders text with entity references replaced by AsciiDoc
+// attribute references, which Asciidoctor substitutes in docinfo files.
+func (d Doc) docinfoText(cs xmlTree.Chunks, collapse bool) string {
+	var text string
+	var refs []string
+	for _, c := range cs {
+		if e := c.Attributes["REFERENCE"]; e != "" {
+			if _, ok := d.Entities[e]; ok {
+				refs = append(refs, e)
+				text += "\x00" + e + "\x01"
+				continue
+			}
+		}
+		text += c.Attributes["TEXT"]
+	}
+	if collapse {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	text = html.EscapeString(text)
+	for _, e := range refs {
+		text = strings.Replace(text, "\x00"+e+"\x01", "{"+e+"}", -1)
+	}
+	return text
+}
+
+// docBook5 returns a DocBook 5 copy of c, or nil if c has no place in one.
+func (d Doc) docBook5(c *xmlTree.Chunk) *xmlTree.Chunk {
+	switch c.Kind {
+	case "TEXT":
+		if e := c.Attributes["REFERENCE"]; e != "" {
+			if _, ok := d.Entities[e]; ok {
+				return &xmlTree.Chunk{Kind: "TEXT", Attributes: map[string]string{"TEXT": "{" + e + "}"}}
+			}
+		}
+		return xmlTree.Chunks{c}.Copy()[0]
+	case "DIRECTIVE", "PROCINST", "ENTITY", "COMMENT":
+		return nil
+	case "corpauthor":
+		if c.Parent != nil && !c.Parent.IsKind("author", "editor") {
+			return d.docBook5(&xmlTree.Chunk{Kind: "author", Children: xmlTree.Chunks{&xmlTree.Chunk{Kind: "orgname", Children: c.Children}}})
+		}
+	}
+	n := &xmlTree.Chunk{Kind: c.Kind, Attributes: make(map[string]string)}
+	if k, ok := docBook5Names[c.Kind]; ok {
+		n.Kind = k
+	}
+	for k, v := range c.Attributes {
+		// upper case attributes are docscii's own bookkeeping
+		if k != strings.ToUpper(k) && k != "condition" {
+			if a, ok := docBook5Attributes[k]; ok {
+				k = a
+			}
+			n.Attributes[k] = v
+		}
+	}
+	children := c.Children
+	if c.IsKind("author", "editor", "othercredit") && children.Contains("firstname", "surname") {
+		// DocBook 5 requires names to be wrapped in a personname
+		name := &xmlTree.Chunk{Kind: "personname"}
+		name.Children = children.Filter("honorific", "firstname", "othername", "surname", "lineage")
+		children = append(xmlTree.Chunks{name}, children.FilterOut("TEXT", "honorific", "firstname", "othername", "surname", "lineage")...)
+	}
+	for _, ch := range children {
+		if nch := d.docBook5(ch); nch != nil {
+			n.AddChild(nch)
+		}
+	}
+	return n
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/clayts/docscii/asciiDoc"
+	"github.com/clayts/docscii/docBook"
+	"github.com/clayts/docscii/file"
+	"github.com/clayts/docscii/translate"
+
+	"github.com/fatih/color"
+)
+
+// batch converts many books in one run; see convertBatch.
+var batch bool
+
+// bookResult is what became of one book in a batch.
+type bookResult struct {
+	input, output string
+	errors        []error
+	// unparsed is set when the errors are from reading and parsing.
+	unparsed bool
+	unknown  map[string]int
+}
+
+// findBooks returns the books under root: each directory with a publican.cfg
+// is a Publican book, and otherwise each directory with a set, book or article
+// in it holds one. The directories within a book are not searched, nor is
+// output.
+func findBooks(root, output string) []string {
+	var books []string
+	outputAbs, _ := filepath.Abs(output)
+	file.Walk(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		// an archive being read cannot hold the output
+		if abs, _ := filepath.Abs(path); file.Input == nil && abs == outputAbs || path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if cfg := filepath.Join(path, "publican.cfg"); file.Exists(cfg) {
+			books = append(books, cfg)
+			return filepath.SkipDir
+		}
+		if doc := docBook.FindDocRoot(path); doc != "." {
+			books = append(books, doc)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return books
+}
+
+// readManifest returns the books listed in a manifest, one path per line
+// relative to the manifest. Blank lines and lines starting with # are ignored.
+func readManifest(manifest string) []string {
+	var books []string
+	for _, l := range strings.Split(file.Read(manifest), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if !filepath.IsAbs(l) {
+			l = filepath.Join(filepath.Dir(manifest), l)
+		}
+		books = append(books, filepath.Clean(l))
+	}
+	return books
+}
+
+// convertBatch converts each book found under input, or listed in the manifest
+// input, into the same place under output, jobs at a time. Brand files are
+// read and parsed once for all of them, but each book converts the
+// Common_Content it includes itself, as the result depends on the book's
+// entities and conditions. It prints a summary of the failures and unknown
+// elements of each book, and returns the exit status.
+func convertBatch(input, output string, s translate.Style, rules []rule) int {
+	var root string
+	var books []string
+	if info, err := file.Stat(input); err == nil && info.IsDir() {
+		root = input
+		books = findBooks(input, output)
+	} else {
+		root = filepath.Dir(input)
+		books = readManifest(input)
+	}
+	if len(books) == 0 {
+		fmt.Println(color.RedString("No books found:"), input)
+		return 1
+	}
+	log.Println("Converting", len(books), "book(s) from", color.CyanString(input), "to", color.CyanString(output))
+
+	results := make([]*bookResult, len(books))
+	claimed := make(map[string]string)
+	var clash bool
+	for i, b := range books {
+		dir := b
+		if info, err := file.Stat(b); err == nil && !info.IsDir() {
+			dir = filepath.Dir(b)
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			// books listed from elsewhere are named after their directory
+			rel = filepath.Base(dir)
+		}
+		results[i] = &bookResult{input: b, output: filepath.Join(output, rel)}
+		if other, ok := claimed[results[i].output]; ok {
+			fmt.Println(color.RedString("Output clash:"), other, "and", b, "would both be written to", results[i].output)
+			clash = true
+		}
+		claimed[results[i].output] = b
+	}
+	if clash {
+		fmt.Println("Put the manifest in a directory holding all the books listed, or rename one of them.")
+		return 1
+	}
+
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, r := range results {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(r *bookResult) {
+			defer func() {
+				if p := recover(); p != nil {
+					r.errors = append(r.errors, fmt.Errorf("%v", p))
+				}
+				<-slots
+				wg.Done()
+			}()
+			r.convert(s, rules)
+		}(r)
+	}
+	wg.Wait()
+	return summarise(results)
+}
+
+func (r *bookResult) convert(s translate.Style, rules []rule) {
+	log.Println("Converting", color.CyanString(r.input), "to", color.CyanString(r.output))
+	db := load(r.input)
+	if db == nil {
+		r.errors = append(r.errors, errors.New("no document found"))
+		return
+	}
+	if len(db.Errors) > 0 {
+		r.errors, r.unparsed = db.Errors, true
+		return
+	}
+	r.unknown = make(map[string]int)
+	var count func(ad *asciiDoc.Doc)
+	count = func(ad *asciiDoc.Doc) {
+		for k, n := range ad.Unknown {
+			r.unknown[k] += n
+		}
+		for _, b := range ad.Books {
+			count(b)
+		}
+	}
+	count(convert(db, r.input, r.output, s, rules))
+}
+
+// summarise prints how each book went and returns 1 if any failed.
+func summarise(results []*bookResult) int {
+	var failed int
+	var unparsed bool
+	fmt.Println("\nSummary:")
+	for _, r := range results {
+		if len(r.errors) > 0 {
+			failed++
+			unparsed = unparsed || r.unparsed
+			fmt.Println(color.RedString("Failed:"), r.input)
+			for _, err := range r.errors {
+				fmt.Println("\t" + strings.Replace(err.Error(), "\n", "\n\t", -1))
+			}
+			continue
+		}
+		var unknown []string
+		for k, n := range r.unknown {
+			unknown = append(unknown, k+" ("+strconv.Itoa(n)+")")
+		}
+		sort.Strings(unknown)
+		fmt.Println(color.GreenString("Converted:"), r.input, "->", r.output)
+		if len(unknown) > 0 {
+			fmt.Println("\t"+color.YellowString("Unknown:"), strings.Join(unknown, ", "))
+		}
+	}
+	fmt.Println(len(results)-failed, "converted,", failed, "failed")
+	if failed > 0 {
+		if unparsed && !docBook.Recover {
+			fmt.Println("Use -recover to convert what can be parsed.")
+		}
+		return 1
+	}
+	return 0
+}
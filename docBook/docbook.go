@@ -1,14 +1,25 @@
 package docBook
 
 import (
-	"io/ioutil"
+	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/clayts/docscii/file"
 	"github.com/clayts/docscii/xmlTree"
+
+	"github.com/fatih/color"
 )
 
+// CommonContentRoot is the directory Publican brands are installed in. A
+// book's publican.cfg may override it with common_content.
+var CommonContentRoot = "/usr/share/publican/Common_Content"
+
+// Recover makes malformed XML a warning rather than an error: the parser skips
+// past each problem and carries on with the rest of the file.
+var Recover bool
+
 func findBetween(s, a, b string) string {
 	aSplit := strings.SplitN(s, a, 2)
 	if len(aSplit) == 2 {
@@ -20,28 +31,30 @@ func findBetween(s, a, b string) string {
 	return ""
 }
 
+// FindDocRoot returns the XML file in dir containing the root element of a
+// document, preferring sets to books and books to articles.
 func FindDocRoot(dir string) string {
+	markers := []string{"</set>", "</book>", "</article>"}
 	var filename string
-	fs, err := ioutil.ReadDir(dir)
+	best := len(markers)
+	fs, err := file.ReadDir(dir)
 	if err != nil {
 		return ""
 	}
 	for _, f := range fs {
 		if filepath.Ext(f.Name()) == ".xml" {
-			b, err2 := ioutil.ReadFile(dir + "/" + f.Name())
+			b, err2 := file.ReadFile(dir + "/" + f.Name())
 			if err2 != nil {
 				continue
 			}
 			s := string(b)
-			for _, m := range []string{"</book>", "</article>"} {
+			for i, m := range markers[:best] {
 				if strings.Contains(s, m) {
 					filename = dir + "/" + f.Name()
+					best = i
 					break
 				}
 			}
-			if filename != "" {
-				break
-			}
 		}
 	}
 	return filepath.Clean(filename)
@@ -67,6 +80,8 @@ type Doc struct {
 	PublicanCfg map[string]string
 	Resources   map[string]string
 	Data        xmlTree.Chunks
+	// Errors lists the files that could not be read or parsed.
+	Errors []error
 }
 
 func New() *Doc {
@@ -80,17 +95,120 @@ func NewFromDir(dir string) *Doc {
 }
 
 func NewFromFile(filename string) *Doc {
+	if info, err := file.Stat(filename); err != nil || info.IsDir() {
+		return nil
+	}
 	d := New()
 	d.loadData(filename)
-	if len(d.Data) == 0 {
+	if len(d.Data) == 0 && len(d.Errors) == 0 {
 		return nil
 	}
 	return d
 }
 
+// parsed is the result of reading and parsing a file, with the messages to
+// print and the errors to record once the document reaches it.
+type parsed struct {
+	cs       xmlTree.Chunks
+	messages [][]interface{}
+	errs     []error
+	done     chan struct{}
+	taken    bool
+}
+
+// readFile reads and parses an XML or entity file in any supported encoding.
+// Files that cannot be read, decoded or parsed have errors, unless Recover is
+// set and the parser could make its way past the problems.
+func readFile(filename string) *parsed {
+	p := &parsed{}
+	b, err := file.ReadFile(filename)
+	if len(b) > 0 {
+		p.messages = append(p.messages, []interface{}{"Processing\t", filename})
+	}
+	if err != nil {
+		p.errs = append(p.errs, err)
+		return p
+	}
+	s, guessed, err := xmlTree.ToUTF8(b)
+	if err != nil {
+		p.errs = append(p.errs, err)
+		return p
+	}
+	if guessed {
+		p.messages = append(p.messages, []interface{}{color.YellowString("Not UTF-8:"), filename, "(decoded as windows-1252)"})
+	}
+	if !Recover {
+		p.cs, err = xmlTree.Parse(s)
+		if err != nil {
+			p.errs = append(p.errs, err)
+		}
+		return p
+	}
+	cs, errs := xmlTree.ParseRecover(s)
+	for _, err := range errs {
+		p.messages = append(p.messages, []interface{}{color.YellowString("Recovered:"), filename + ":", err})
+	}
+	p.cs = cs
+	return p
+}
+
+// report prints what happened while p was read and adds its errors to d.Errors.
+func (d *Doc) report(filename string, p *parsed) xmlTree.Chunks {
+	for _, m := range p.messages {
+		fmt.Println(m...)
+	}
+	for _, err := range p.errs {
+		d.fail(filename, err)
+	}
+	return p.cs
+}
+
+// parseFile parses filename, reporting any problems.
+func (d *Doc) parseFile(filename string) xmlTree.Chunks {
+	return d.report(filename, readFile(filename))
+}
+
+// commonContent holds the brand files read so far. They are the same for every
+// book converted in a run, so each is only read and parsed once.
+var commonContent = struct {
+	sync.Mutex
+	files map[string]*parsed
+}{files: make(map[string]*parsed)}
+
+// parseCommonContent is parseFile for brand files, giving each use a copy of
+// the one parsed.
+func (d *Doc) parseCommonContent(filename string) xmlTree.Chunks {
+	commonContent.Lock()
+	p, ok := commonContent.files[filename]
+	if !ok {
+		p = &parsed{done: make(chan struct{})}
+		commonContent.files[filename] = p
+	}
+	commonContent.Unlock()
+	if ok {
+		<-p.done
+	} else {
+		r := readFile(filename)
+		p.cs, p.messages, p.errs = r.cs, r.messages, r.errs
+		close(p.done)
+	}
+	return d.report(filename, &parsed{cs: p.cs.Copy(), messages: p.messages, errs: p.errs})
+}
+
+func (d *Doc) fail(filename string, err error) {
+	fmt.Println(color.RedString("Could not parse:"), filename+":", err)
+	d.Errors = append(d.Errors, fmt.Errorf("%s: %v", filename, err))
+}
+
 func (d *Doc) loadData(filename string) {
+	parseFile := d.parseFile
+	if Jobs > 1 {
+		pf := newPrefetcher(d)
+		defer pf.wait()
+		parseFile = pf.parseFile
+	}
 	directory := filepath.Dir(filename)
-	d.Data = xmlTree.New(file.Read(filename))
+	d.Data = parseFile(filename)
 
 	entityFiles := make(map[string]struct{})
 	var process func(dir string, cs xmlTree.Chunks)
@@ -102,9 +220,9 @@ func (d *Doc) loadData(filename string) {
 					if f := findBetween(c.Attributes["DIRECTIVE"], "<!ENTITY % BOOK_ENTITIES SYSTEM \"", "\">"); f != "" {
 						f = filepath.Clean(dir + "/" + f)
 						chs := c.Children
-						if _, ok := entityFiles[f]; !ok {
+						if _, ok := entityFiles[f]; !ok && file.Exists(f) {
 							entityFiles[f] = struct{}{}
-							n := xmlTree.New(file.Read(f))
+							n := parseFile(f)
 							c.AddChildren(n)
 							process(filepath.Dir(f), n)
 						}
@@ -121,10 +239,8 @@ func (d *Doc) loadData(filename string) {
 					}
 				case c.IsKind("imagedata"):
 					if href, ok := c.Attributes["fileref"]; ok {
-						var src string
-						if d.PublicanBrandDir() != "" && strings.HasPrefix(href, "Common_Content/") {
-							src = d.PublicanBrandDir() + strings.Replace(href, "Common_Content/", "", -1)
-						} else {
+						src := d.CommonContent(href)
+						if src == "" {
 							src = dir + "/" + href
 						}
 						c.Attributes["DIR"], _ = filepath.Rel(directory, dir)
@@ -132,10 +248,9 @@ func (d *Doc) loadData(filename string) {
 					}
 				case c.IsKind("include"):
 					if href, ok := c.Attributes["href"]; ok {
-						var fname string
-						if d.PublicanBrandDir() != "" && strings.HasPrefix(href, "Common_Content/") {
-							fname = d.PublicanBrandDir() + strings.Replace(href, "Common_Content/", "", -1)
-						} else {
+						fname := d.CommonContent(href)
+						brand := fname != ""
+						if !brand {
 							fname = filepath.Clean(dir + "/" + href)
 						}
 
@@ -145,7 +260,12 @@ func (d *Doc) loadData(filename string) {
 								c.Attributes["DIR"], _ = filepath.Rel(directory, dir)
 								d.Resources[filepath.Clean(c.Attributes["DIR"]+"/"+href)] = fname
 							} else {
-								newData := xmlTree.New(file.Read(fname))
+								var newData xmlTree.Chunks
+								if brand {
+									newData = d.parseCommonContent(fname)
+								} else {
+									newData = parseFile(fname)
+								}
 								c.AddChildren(newData)
 								process(filepath.Dir(fname), newData)
 							}
@@ -163,29 +283,127 @@ func (d *Doc) loadData(filename string) {
 	process(directory, d.Data)
 }
 
-func NewFromPublicanCfg(filename string) *Doc {
+// ParsePublicanCfg parses the YAML-style key: value pairs of a publican.cfg
+// file. Comments are ignored, surrounding quotes are removed and the items of
+// block (- item) or flow ([item, item]) lists are joined with commas.
+func ParsePublicanCfg(s string) map[string]string {
 	publicanCfg := make(map[string]string)
-	s := file.Read(filename)
+	unquote := func(v string) string {
+		v = strings.TrimSpace(v)
+		if len(v) > 1 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		return v
+	}
+	uncomment := func(l string) string {
+		var quote rune
+		for i, r := range l {
+			switch {
+			case quote != 0:
+				if r == quote {
+					quote = 0
+				}
+			case r == '"' || r == '\'':
+				quote = r
+			case r == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t'):
+				return l[:i]
+			}
+		}
+		return l
+	}
+	var key string
 	for _, l := range strings.Split(s, "\n") {
-		l = strings.Replace(l, "\"", "", -1)
+		l = strings.TrimRight(uncomment(l), " \t\r")
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if item := strings.TrimSpace(l); key != "" && strings.HasPrefix(item, "- ") {
+			item = unquote(strings.TrimPrefix(item, "- "))
+			if publicanCfg[key] != "" {
+				item = publicanCfg[key] + "," + item
+			}
+			publicanCfg[key] = item
+			continue
+		}
 		lSplit := strings.SplitN(l, ":", 2)
-		if len(lSplit) == 2 {
-			publicanCfg[strings.TrimSpace(lSplit[0])] = strings.TrimSpace(lSplit[1])
+		if len(lSplit) != 2 {
+			continue
+		}
+		key = strings.TrimSpace(lSplit[0])
+		value := strings.TrimSpace(lSplit[1])
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquote(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			value = strings.Join(items, ",")
 		}
+		publicanCfg[key] = unquote(value)
 	}
+	return publicanCfg
+}
+
+func NewFromPublicanCfg(filename string) *Doc {
+	publicanCfg := ParsePublicanCfg(file.Read(filename))
 
 	if _, ok := publicanCfg["xml_lang"]; !ok {
 		return nil
 	}
 	d := New()
 	d.PublicanCfg = publicanCfg
-	d.loadData(FindDocRoot(filepath.Dir(filename) + "/" + publicanCfg["xml_lang"]))
+	dir := filepath.Dir(filename) + "/" + publicanCfg["xml_lang"]
+	root := FindDocRoot(dir)
+	// Publican's main file defaults to the docname
+	for _, name := range []string{publicanCfg["mainfile"], publicanCfg["docname"]} {
+		if name != "" && file.Exists(dir+"/"+name+".xml") {
+			root = filepath.Clean(dir + "/" + name + ".xml")
+			break
+		}
+	}
+	d.loadData(root)
 	return d
 }
 
-func (d Doc) PublicanBrandDir() string {
+// PublicanBrandDirs returns the directories searched for Common_Content files,
+// most specific first: the book's brand and then the common brand, each in the
+// book's language and then in en-US, as Publican does.
+func (d Doc) PublicanBrandDirs() []string {
 	if d.PublicanCfg == nil {
+		return nil
+	}
+	root := CommonContentRoot
+	if r := d.PublicanCfg["common_content"]; r != "" {
+		root = r
+	}
+	var dirs []string
+	seen := make(map[string]struct{})
+	for _, brand := range []string{d.PublicanCfg["brand"], "common"} {
+		for _, lang := range []string{d.PublicanCfg["xml_lang"], "en-US"} {
+			if brand == "" || lang == "" {
+				continue
+			}
+			dir := filepath.Join(root, brand, lang)
+			if _, ok := seen[dir]; !ok {
+				seen[dir] = struct{}{}
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// CommonContent returns the file a Common_Content/ reference resolves to, or
+// "" if href is not such a reference or no brand provides it.
+func (d Doc) CommonContent(href string) string {
+	if !strings.HasPrefix(href, "Common_Content/") {
 		return ""
 	}
-	return "/usr/share/publican/Common_Content/" + d.PublicanCfg["brand"] + "/" + d.PublicanCfg["xml_lang"] + "/"
+	for _, dir := range d.PublicanBrandDirs() {
+		if f := filepath.Join(dir, strings.TrimPrefix(href, "Common_Content/")); file.Exists(f) {
+			return f
+		}
+	}
+	return ""
 }
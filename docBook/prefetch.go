@@ -0,0 +1,100 @@
+package docBook
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/clayts/docscii/file"
+	"github.com/clayts/docscii/xmlTree"
+)
+
+// Jobs is how many files are read and parsed at once while a document loads.
+var Jobs = 1
+
+// prefetcher reads and parses the files a document includes ahead of the
+// document reaching them, Jobs at a time. Each file found is scanned for the
+// files it includes in turn, so the whole tree is fetched while the document
+// is still being put together in order.
+type prefetcher struct {
+	d *Doc
+	// publican resolves Common_Content references without touching d, which
+	// is being put together meanwhile.
+	publican Doc
+	slots    chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	files    map[string]*parsed
+}
+
+func newPrefetcher(d *Doc) *prefetcher {
+	return &prefetcher{d: d, publican: Doc{PublicanCfg: d.PublicanCfg}, slots: make(chan struct{}, Jobs), files: make(map[string]*parsed)}
+}
+
+// fetch starts reading filename unless it has been already.
+func (pf *prefetcher) fetch(filename string) *parsed {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	if p, ok := pf.files[filename]; ok {
+		return p
+	}
+	p := &parsed{done: make(chan struct{})}
+	pf.files[filename] = p
+	pf.wg.Add(1)
+	go func() {
+		defer pf.wg.Done()
+		pf.slots <- struct{}{}
+		result := readFile(filename)
+		<-pf.slots
+		p.cs, p.messages, p.errs = result.cs, result.messages, result.errs
+		// the document changes the chunks once it has them
+		pf.scan(filepath.Dir(filename), p.cs)
+		close(p.done)
+	}()
+	return p
+}
+
+// scan fetches the files cs includes. Conditions are not checked, as whether
+// an include is wanted is only decided when the document reaches it.
+func (pf *prefetcher) scan(dir string, cs xmlTree.Chunks) {
+	for _, c := range cs.Flatten() {
+		switch {
+		case c.IsKind("DIRECTIVE"):
+			if f := findBetween(c.Attributes["DIRECTIVE"], "<!ENTITY % BOOK_ENTITIES SYSTEM \"", "\">"); f != "" {
+				if f = filepath.Clean(dir + "/" + f); file.Exists(f) {
+					pf.fetch(f)
+				}
+			}
+		case c.IsKind("include") && c.Attributes["parse"] != "text":
+			if href, ok := c.Attributes["href"]; ok {
+				if pf.publican.CommonContent(href) != "" {
+					// brand files are shared with other books; see parseCommonContent
+					continue
+				}
+				if fname := filepath.Clean(dir + "/" + href); file.Exists(fname) {
+					pf.fetch(fname)
+				}
+			}
+		}
+	}
+}
+
+// parseFile is Doc.parseFile, but takes the fetched file if it has not been
+// used already. A file included twice is parsed again for its second use,
+// because the first copy has become part of the document.
+func (pf *prefetcher) parseFile(filename string) xmlTree.Chunks {
+	p := pf.fetch(filename)
+	<-p.done
+	pf.mu.Lock()
+	taken := p.taken
+	p.taken = true
+	pf.mu.Unlock()
+	if taken {
+		return pf.d.parseFile(filename)
+	}
+	return pf.d.report(filename, p)
+}
+
+// wait returns once every fetch has finished, used or not.
+func (pf *prefetcher) wait() {
+	pf.wg.Wait()
+}
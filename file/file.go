@@ -3,30 +3,43 @@ package file
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
 	"path/filepath"
+
+	"github.com/fatih/color"
 )
 
+// Read returns the contents of filename, or "" if it is not a readable file.
+// Failures other than the file being absent are reported.
 func Read(filename string) string {
-	if filename == "" {
+	if info, err := Stat(filename); filename == "" || err != nil || info.IsDir() {
 		return ""
 	}
-	b, _ := ioutil.ReadFile(filename)
-	if string(b) != "" {
-		fmt.Println("Processing\t", filename)
+	b, err := ReadBytes(filename)
+	if err != nil {
+		fmt.Println(color.RedString("Could not read:"), filename, err)
 	}
 	return string(b)
 }
 
+// ReadBytes returns the contents of filename along with any error reading it.
+func ReadBytes(filename string) ([]byte, error) {
+	b, err := ReadFile(filename)
+	if len(b) > 0 {
+		fmt.Println("Processing\t", filename)
+	}
+	return b, err
+}
+
 func Write(filename, contents string) {
 	fmt.Println("Creating\t", filename)
-	err := os.MkdirAll(filepath.Dir(filename), 0777)
+	out, err := Output.Create(filename)
 	if err != nil {
 		panic(err)
 	}
-	err = ioutil.WriteFile(filename, []byte(contents), 0644)
-	if err != nil {
+	if _, err = io.WriteString(out, contents); err != nil {
+		panic(err)
+	}
+	if err = out.Close(); err != nil {
 		panic(err)
 	}
 }
@@ -36,34 +49,24 @@ func Copy(src, dst string) error {
 		panic("file not found --" + src + " " + dst)
 	}
 	fmt.Println("Copying\t\t", dst)
-	err := os.MkdirAll(filepath.Dir(dst), 0777)
-	if err != nil {
-		return err
-	}
-	in, err := os.Open(src)
+	in, err := Open(src)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	out, err := os.Create(dst)
+	out, err := Output.Create(dst)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		cerr := out.Close()
-		if err == nil {
-			err = cerr
-		}
-	}()
 	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
 		return err
 	}
-	err = out.Sync()
-	return err
+	return out.Close()
 }
 
 func Exists(filename string) bool {
-	if _, err := os.Stat(filename); err == nil {
+	if _, err := Stat(filename); err == nil {
 		return true
 	}
 	return false
@@ -0,0 +1,236 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Input is where files are read from when it has them: an archive, or the
+// document given on standard input. Anything it does not have, such as the
+// brands installed on the system or the files a document from standard input
+// includes, is read from the filesystem.
+var Input fs.FS
+
+// inInput returns the name of filename within Input, if Input has it.
+func inInput(filename string) (string, bool) {
+	if Input == nil || filepath.IsAbs(filename) {
+		return "", false
+	}
+	name := filepath.ToSlash(filepath.Clean(filename))
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	if _, err := fs.Stat(Input, name); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+func Open(filename string) (fs.File, error) {
+	if name, ok := inInput(filename); ok {
+		return Input.Open(name)
+	}
+	return os.Open(filename)
+}
+
+func Stat(filename string) (fs.FileInfo, error) {
+	if name, ok := inInput(filename); ok {
+		return fs.Stat(Input, name)
+	}
+	return os.Stat(filename)
+}
+
+func ReadDir(dir string) ([]fs.DirEntry, error) {
+	if name, ok := inInput(dir); ok {
+		return fs.ReadDir(Input, name)
+	}
+	return os.ReadDir(dir)
+}
+
+// ReadFile returns the contents of filename without reporting it.
+func ReadFile(filename string) ([]byte, error) {
+	if name, ok := inInput(filename); ok {
+		return fs.ReadFile(Input, name)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// Walk is filepath.WalkDir over whichever of Input and the filesystem has
+// root.
+func Walk(root string, fn fs.WalkDirFunc) error {
+	if name, ok := inInput(root); ok {
+		return fs.WalkDir(Input, name, func(p string, d fs.DirEntry, err error) error {
+			return fn(filepath.FromSlash(p), d, err)
+		})
+	}
+	return filepath.WalkDir(root, fn)
+}
+
+// IsArchive reports whether filename is named as an archive docscii can read
+// and write.
+func IsArchive(filename string) bool {
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(strings.ToLower(filename), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenArchive returns the contents of a .zip, .tar, .tar.gz or .tgz file.
+func OpenArchive(filename string) (fs.FS, error) {
+	if strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		return zip.OpenReader(filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(strings.ToLower(filename), ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return newMemFS(files), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if name := path.Clean(strings.TrimPrefix(h.Name, "/")); fs.ValidPath(name) {
+			files[name] = b
+		}
+	}
+}
+
+// ReadStdin returns what is given on standard input as a file named "-".
+func ReadStdin() (fs.FS, error) {
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return newMemFS(map[string][]byte{"-": b}), nil
+}
+
+// memFS holds files in memory by name. Its directories are the ones the names
+// imply, listed once when it is made.
+type memFS struct {
+	files map[string][]byte
+	dirs  map[string][]fs.DirEntry
+}
+
+func newMemFS(files map[string][]byte) memFS {
+	m := memFS{files: files, dirs: map[string][]fs.DirEntry{".": nil}}
+	for name, b := range files {
+		info := memInfo{name: path.Base(name), size: int64(len(b))}
+		for p := name; p != "."; p = path.Dir(p) {
+			dir := path.Dir(p)
+			_, listed := m.dirs[dir]
+			m.dirs[dir] = append(m.dirs[dir], fs.FileInfoToDirEntry(info))
+			if listed {
+				// dir, and so the directories holding it, are already listed
+				break
+			}
+			info = memInfo{name: path.Base(dir), dir: true}
+		}
+	}
+	for _, entries := range m.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return m
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if b, ok := m.files[name]; ok {
+		return &memFile{memInfo{name: path.Base(name), size: int64(len(b))}, bytes.NewReader(b)}, nil
+	}
+	entries, ok := m.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memDir{memInfo{name: path.Base(name), dir: true}, entries}, nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return time.Time{} }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+func (i memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type memFile struct {
+	info memInfo
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memDir struct {
+	info    memInfo
+	entries []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, errors.New(d.info.name + " is a directory")
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,151 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+var archived = map[string]string{
+	"publican.cfg":                  "xml_lang: en-US\n",
+	"en-US/Book.xml":                "<book/>\n",
+	"en-US/Chapter.xml":             "<chapter/>\n",
+	"en-US/images/icon.svg":         "<svg/>",
+	"en-US/images/shots/screen.png": "\x89PNG",
+	"en-US/empty.txt":               "",
+}
+
+// writeArchive writes archived under name through an archive Sink, with a
+// file outside it, and returns the archive's path.
+func writeArchive(t *testing.T, dir, name string) string {
+	t.Helper()
+	archive := filepath.Join(dir, name)
+	sink := NewArchive(archive)
+	for _, f := range append(names(archived), "../outside.txt") {
+		w, err := sink.Create(filepath.Join(archive, filepath.FromSlash(f)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(archived[f]))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func names(m map[string]string) []string {
+	var names []string
+	for n := range m {
+		names = append(names, n)
+	}
+	return names
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, name := range []string{"book.tar.gz", "book.tgz", "book.tar", "book.zip", "BOOK.ZIP"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := writeArchive(t, dir, name)
+			if _, err := os.Stat(filepath.Join(dir, "outside.txt")); err != nil {
+				t.Errorf("file outside the archive not written: %v", err)
+			}
+			fsys, err := OpenArchive(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fstest.TestFS(fsys, names(archived)...); err != nil {
+				t.Error(err)
+			}
+			for f, want := range archived {
+				if b, err := fs.ReadFile(fsys, f); err != nil || string(b) != want {
+					t.Errorf("%s = %q, %v, want %q", f, b, err, want)
+				}
+			}
+			if _, err := fs.Stat(fsys, "outside.txt"); err == nil {
+				t.Errorf("outside.txt is in the archive")
+			}
+
+			// the same files make the same archive
+			again := writeArchive(t, t.TempDir(), name)
+			a, _ := ioutil.ReadFile(archive)
+			b, _ := ioutil.ReadFile(again)
+			if !bytes.Equal(a, b) {
+				t.Errorf("writing the archive twice gave different bytes")
+			}
+		})
+	}
+}
+
+func TestOpenArchiveErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"bad.zip", "bad.tar.gz", "bad.tar"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("not an archive"), 0644)
+		if _, err := OpenArchive(filepath.Join(dir, name)); err == nil {
+			t.Errorf("OpenArchive(%s) succeeded", name)
+		}
+	}
+	if _, err := OpenArchive(filepath.Join(dir, "missing.tgz")); err == nil {
+		t.Errorf("OpenArchive of a missing file succeeded")
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	files := make(map[string][]byte)
+	for f, s := range archived {
+		files[f] = []byte(s)
+	}
+	m := newMemFS(files)
+	if err := fstest.TestFS(m, names(archived)...); err != nil {
+		t.Error(err)
+	}
+	entries, err := fs.ReadDir(m, ".")
+	if err != nil || len(entries) != 2 || entries[0].Name() != "en-US" || !entries[0].IsDir() || entries[1].Name() != "publican.cfg" {
+		t.Errorf("ReadDir(.) = %v, %v", entries, err)
+	}
+	for _, name := range []string{"missing", "en-US/missing", "en-US/images/icon.svg/x", "en-U"} {
+		if _, err := m.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q) error = %v, want not exist", name, err)
+		}
+	}
+	if _, err := m.Open("../x"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(../x) error = %v, want invalid", err)
+	}
+}
+
+func TestInput(t *testing.T) {
+	defer func() { Input = nil }()
+	archive := writeArchive(t, t.TempDir(), "book.tgz")
+	var err error
+	if Input, err = OpenArchive(archive); err != nil {
+		t.Fatal(err)
+	}
+	if !Exists("en-US/Book.xml") || Read("en-US/Book.xml") != "<book/>\n" {
+		t.Errorf("en-US/Book.xml not read from Input")
+	}
+	if info, err := Stat("en-US/images"); err != nil || !info.IsDir() {
+		t.Errorf("Stat(en-US/images) = %v, %v", info, err)
+	}
+	var walked []string
+	Walk("en-US", func(p string, d fs.DirEntry, err error) error {
+		walked = append(walked, filepath.ToSlash(p))
+		return err
+	})
+	want := []string{"en-US", "en-US/Book.xml", "en-US/Chapter.xml", "en-US/empty.txt", "en-US/images", "en-US/images/icon.svg", "en-US/images/shots", "en-US/images/shots/screen.png"}
+	if fmt.Sprint(walked) != fmt.Sprint(want) {
+		t.Errorf("Walk() visited %v, want %v", walked, want)
+	}
+	// what Input lacks comes from the filesystem
+	if Exists("en-US/Missing.xml") || !Exists(archive) {
+		t.Errorf("Exists() did not fall back to the filesystem")
+	}
+}
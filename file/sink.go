@@ -0,0 +1,164 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink is somewhere files are written to.
+type Sink interface {
+	Create(filename string) (io.WriteCloser, error)
+	// Close finishes writing; nothing can be created afterwards.
+	Close() error
+}
+
+// Output is where Write and Copy put files. By default it is the filesystem.
+var Output Sink = dirSink{}
+
+type dirSink struct{}
+
+func (dirSink) Create(filename string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return syncFile{f}, nil
+}
+
+func (dirSink) Close() error { return nil }
+
+type syncFile struct{ *os.File }
+
+func (f syncFile) Close() error {
+	err := f.Sync()
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// archiveSink collects the files created under root and writes them into an
+// archive named root when closed, in the format its name gives.
+type archiveSink struct {
+	root  string
+	mu    sync.Mutex
+	files map[string]*bytes.Buffer
+}
+
+// NewArchive returns a Sink which writes everything created under name into
+// the archive name, a .zip, .tar, .tar.gz or .tgz file.
+func NewArchive(name string) Sink {
+	return &archiveSink{root: filepath.Clean(name), files: make(map[string]*bytes.Buffer)}
+}
+
+type entry struct {
+	*bytes.Buffer
+}
+
+func (entry) Close() error { return nil }
+
+// within returns the name of filename in the archive, if it belongs there.
+func (a *archiveSink) within(filename string) (string, bool) {
+	rel, err := filepath.Rel(a.root, filepath.Clean(filename))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return rel, true
+}
+
+// Destination returns where filename is written: the archive holding it when
+// Output is one, and otherwise filename itself.
+func Destination(filename string) string {
+	if a, ok := Output.(*archiveSink); ok {
+		if _, ok := a.within(filename); ok {
+			return a.root
+		}
+	}
+	return filename
+}
+
+func (a *archiveSink) Create(filename string) (io.WriteCloser, error) {
+	rel, ok := a.within(filename)
+	if !ok {
+		return dirSink{}.Create(filename)
+	}
+	b := new(bytes.Buffer)
+	a.mu.Lock()
+	a.files[filepath.ToSlash(rel)] = b
+	a.mu.Unlock()
+	return entry{b}, nil
+}
+
+func (a *archiveSink) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var names []string
+	for name := range a.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := os.MkdirAll(filepath.Dir(a.root), 0777); err != nil {
+		return err
+	}
+	f, err := os.Create(a.root)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// a fixed time, so converting the same book gives the same archive
+	modified := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	lower := strings.ToLower(a.root)
+	if strings.HasSuffix(lower, ".zip") {
+		zw := zip.NewWriter(f)
+		for _, name := range names {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(a.files[name].Bytes()); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if !strings.HasSuffix(lower, ".tar") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		b := a.files[name].Bytes()
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: modified, Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
@@ -0,0 +1,28 @@
+package file
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDestination(t *testing.T) {
+	defer func(o Sink) { Output = o }(Output)
+	out := filepath.Join("out", "book.zip")
+	Output = NewArchive(out)
+	tests := map[string]string{
+		filepath.Join(out, "master.adoc"):              out,
+		filepath.Join(out, "en-US", "master.adoc"):     out,
+		filepath.Join(out, "..", "book.zip", "a.adoc"): out,
+		filepath.Join("out", "other", "master.adoc"):   filepath.Join("out", "other", "master.adoc"),
+		filepath.Join("out", "book.zipped", "a.adoc"):  filepath.Join("out", "book.zipped", "a.adoc"),
+	}
+	for in, want := range tests {
+		if got := Destination(in); got != want {
+			t.Errorf("Destination(%q) = %q, want %q", in, got, want)
+		}
+	}
+	Output = dirSink{}
+	if got := Destination(filepath.Join(out, "master.adoc")); got != filepath.Join(out, "master.adoc") {
+		t.Errorf("Destination() without an archive = %q", got)
+	}
+}
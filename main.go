@@ -3,38 +3,121 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/clayts/docscii/asciiDoc"
 	"github.com/clayts/docscii/docBook"
+	"github.com/clayts/docscii/file"
+	"github.com/clayts/docscii/po"
+	"github.com/clayts/docscii/translate"
 
 	"github.com/fatih/color"
 )
 
-func readArgs() (string, string, Style) {
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, " ") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// languages lists the Publican translations to convert as well as the source.
+var languages string
+
+// rulesFile names a file of rewrite rules applied to the DocBook before it is
+// translated.
+var rulesFile string
+
+// poDetails lists each fuzzy and untranslated message of the languages
+// converted, rather than only counting them.
+var poDetails bool
+
+// jobs is how many files are read, translated or copied at once.
+var jobs = 1
+
+// pot requests PO files mapping DocBook messages to the AsciiDoc they became.
+var pot bool
+
+func readArgs() (string, string, translate.Style) {
 	flag.Usage = func() {
-		fmt.Println(color.GreenString("docscii") + " v2\nDocBook to AsciiDoc converter by Clayton Spicer\n\nUsage:\n  docscii input_dir output_dir\n  Or:\n  docscii input/publican.cfg output_dir\n  Or:\n  db2d input_file.xml output_dir\n\nOptions:")
+		fmt.Println(color.GreenString("docscii") + " v2\nDocBook to AsciiDoc converter by Clayton Spicer\n\nUsage:\n  docscii input_dir output_dir\n  Or:\n  docscii input/publican.cfg output_dir\n  Or:\n  db2d input_file.xml output_dir\n\nThe input may also be a .zip, .tar, .tar.gz or .tgz archive of any of these, or - to read a\ndocument from standard input. The output may be an archive to write, or - to write a single\nfile to standard output.\n\nOptions:")
 		flag.PrintDefaults()
 	}
 	var input, output string
-	s := NewStyle()
+	s := translate.NewStyle()
 	var cQuotes, mQuotes, iQuotes, sQuotes, bQuotes, hQuotes string
-	flag.StringVar(&cQuotes, "custom", strings.Join(DefaultStyle["custom"], ","), "comma-separated list of custom semantic tags to preserve")
-	flag.StringVar(&mQuotes, "monospace", strings.Join(DefaultStyle["monospace"], ","), "comma-separated list of DocBook elements to render as in-line literal text")
-	flag.StringVar(&sQuotes, "superscript", strings.Join(DefaultStyle["superscript"], ","), "comma-separated list of DocBook elements to render as in-line superscript text")
-	flag.StringVar(&iQuotes, "italic", strings.Join(DefaultStyle["italic"], ","), "comma-separated list of DocBook elements to render as in-line italic text")
-	flag.StringVar(&bQuotes, "bold", strings.Join(DefaultStyle["bold"], ","), "comma-separated list of DocBook elements to render as in-line bold text")
-	flag.StringVar(&hQuotes, "highlight", strings.Join(DefaultStyle["highlight"], ","), "comma-separated list of DocBook elements to render as in-line highlighted text")
+	flag.StringVar(&cQuotes, "custom", strings.Join(translate.DefaultStyle["custom"], ","), "comma-separated list of custom semantic tags to preserve")
+	flag.StringVar(&mQuotes, "monospace", strings.Join(translate.DefaultStyle["monospace"], ","), "comma-separated list of DocBook elements to render as in-line literal text")
+	flag.StringVar(&sQuotes, "superscript", strings.Join(translate.DefaultStyle["superscript"], ","), "comma-separated list of DocBook elements to render as in-line superscript text")
+	flag.StringVar(&iQuotes, "italic", strings.Join(translate.DefaultStyle["italics"], ","), "comma-separated list of DocBook elements to render as in-line italic text")
+	flag.StringVar(&bQuotes, "bold", strings.Join(translate.DefaultStyle["bold"], ","), "comma-separated list of DocBook elements to render as in-line bold text")
+	flag.StringVar(&hQuotes, "highlight", strings.Join(translate.DefaultStyle["highlight"], ","), "comma-separated list of DocBook elements to render as in-line highlighted text")
+	var inlineAdmonitions string
+	flag.StringVar(&inlineAdmonitions, "inlineadmonitions", strings.Join(translate.DefaultStyle["inlineadmonitions"], ","), "comma-separated list of admonitions to render in-line (NOTE: text) when they contain a single untitled paragraph")
+	var admonitionTypes listFlag
+	flag.Var(&admonitionTypes, "admonition", "selector=type rendering matching elements as admonitions, e.g. 'sidebar[role=note]=note' (may be repeated)")
+	var legalNotice string
+	flag.StringVar(&legalNotice, "legalnotice", translate.DefaultStyle["legalnotice"][0], "where to put the legal notice: \"file\" to include it from legal-notice.adoc or \"preamble\" to write it in-line")
+	var docinfo string
+	flag.StringVar(&docinfo, "docinfo", strings.Join(translate.DefaultStyle["docinfo"], ","), "comma-separated list of docinfo files to generate from the book's metadata (xml, html)")
+	var revhistory string
+	flag.StringVar(&revhistory, "revhistory", translate.DefaultStyle["revhistory"][0], "how to render revision histories: \"table\" or \"list\"")
+	flag.StringVar(&docBook.CommonContentRoot, "brandroot", docBook.CommonContentRoot, "directory containing Publican brands, used to resolve Common_Content files")
+	var commonContent string
+	flag.StringVar(&commonContent, "commoncontent", translate.DefaultStyle["commoncontent"][0], "what to do with included Common_Content files: \"convert\" them into local AsciiDoc files or \"omit\" them")
+	var comments string
+	flag.StringVar(&comments, "comments", translate.DefaultStyle["comments"][0], "what to do with XML comments: \"keep\" them as AsciiDoc comments or \"drop\" them")
+	flag.StringVar(&languages, "langs", "", "comma-separated list of Publican translations to convert from their PO files, or \"all\"; each language is written to its own directory of output_dir")
+	flag.BoolVar(&poDetails, "podetails", false, "list each fuzzy and untranslated message of the converted languages, not only how many there are")
+	flag.BoolVar(&docBook.Recover, "recover", false, "skip past malformed XML, as libxml2's recover mode does, instead of stopping; the problems are still reported")
+	flag.StringVar(&rulesFile, "rules", "", "file of rules rewriting the DocBook before it is converted, one 'selector => action argument' per line, e.g. \"para[@role='prereq'] => wrap <formalpara><title>Prerequisites</title><content/></formalpara>\"; see README.md")
+	flag.BoolVar(&batch, "batch", false, "convert every book found under input_dir, each into the same place under output_dir, or the books listed one per line in the manifest file input_file")
+	flag.IntVar(&jobs, "j", 1, "number of files to read, translate and copy at once")
+	flag.BoolVar(&pot, "pot", false, "write po/master.pot mapping each DocBook message to its AsciiDoc text, and po/LANG.po carrying over the translations of each converted language")
+	var roles, ignoredRoles string
+	flag.StringVar(&roles, "roles", strings.Join(translate.DefaultStyle["roles"], ","), "comma-separated list of DocBook role values to preserve as AsciiDoc roles (all if blank)")
+	flag.StringVar(&ignoredRoles, "ignoreroles", strings.Join(translate.DefaultStyle["ignoredroles"], ","), "comma-separated list of DocBook role values to discard")
+	var procinsts listFlag
+	flag.Var(&procinsts, "procinst", "target=snippet replacing processing instructions with AsciiDoc, where {text} is the instruction and \\n a new line, e.g. 'asciidoc-toc=toc::[]' or 'html=\\n++++\\n{text}\\n++++\\n' (may be repeated)")
+	var templates listFlag
+	flag.Var(&templates, "template", "selector=template mapping a DocBook element to in-line AsciiDoc, where the selector is kind, kind[attribute=value] or parent>kind[attribute=value] and {text} marks the contents, e.g. 'emphasis[role=strong]=*{text}*' ; use *[role=value] to map a role on any element (may be repeated)")
 
 	flag.Parse()
+	if jobs < 1 {
+		jobs = 1
+	}
+	docBook.Jobs, asciiDoc.Jobs, translate.Jobs = jobs, jobs, jobs
 	s.AddFromString("custom", cQuotes)
 	s.AddFromString("monospace", mQuotes)
 	s.AddFromString("superscript", sQuotes)
 	s.AddFromString("italics", iQuotes)
 	s.AddFromString("bold", bQuotes)
 	s.AddFromString("highlight", hQuotes)
+	s.AddFromString("inlineadmonitions", inlineAdmonitions)
+	if len(admonitionTypes) > 0 {
+		s.Add("admonitiontypes", translate.DefaultStyle["admonitiontypes"]...)
+		s.Add("admonitiontypes", admonitionTypes...)
+	}
+	s.AddFromString("legalnotice", legalNotice)
+	s.AddFromString("docinfo", docinfo)
+	s.AddFromString("revhistory", revhistory)
+	s.AddFromString("commoncontent", commonContent)
+	s.AddFromString("comments", comments)
+	s.AddFromString("roles", roles)
+	s.AddFromString("ignoredroles", ignoredRoles)
+	if len(procinsts) > 0 {
+		s.Add("procinsts", translate.DefaultStyle["procinsts"]...)
+		s.Add("procinsts", procinsts...)
+	}
+	if len(templates) > 0 {
+		s.Add("templates", templates...)
+	}
 	if len(flag.Args()) < 2 {
 		flag.Usage()
 		os.Exit(1)
@@ -45,9 +128,118 @@ func readArgs() (string, string, Style) {
 	return input, output, s
 }
 
+// stdout is where the result is written when output is "-". Everything else
+// printed then goes to standard error.
+var stdout io.Writer = os.Stdout
+
 func main() {
 	input, output, s := readArgs()
+	if output == "-" {
+		if batch || languages != "" || pot {
+			fmt.Println(color.RedString("Cannot write to standard output:"), "-batch, -langs and -pot write more than one file")
+			os.Exit(1)
+		}
+		os.Stdout = os.Stderr
+	} else if file.IsArchive(output) {
+		file.Output = file.NewArchive(output)
+	}
+	if batch {
+		status := convertBatch(openInput(input), output, s, readRules())
+		closeOutput()
+		os.Exit(status)
+	}
 	log.Println("Converting", color.CyanString(input), "to", color.CyanString(output))
+	input = openInput(input)
+	rules := readRules()
+	db := load(input)
+	if db == nil {
+		panic("file not found")
+	}
+	if len(db.Errors) > 0 {
+		fmt.Println(color.RedString("Failed:"), len(db.Errors), "file(s) could not be read or parsed")
+		if !docBook.Recover {
+			fmt.Println("Use -recover to convert what can be parsed.")
+		}
+		os.Exit(1)
+	}
+	convert(db, input, output, s, rules)
+	closeOutput()
+}
+
+// openInput reads standard input when input is "-", or the archive input
+// names, and returns the name of the document within it.
+func openInput(input string) string {
+	var err error
+	switch {
+	case input == "-":
+		file.Input, err = file.ReadStdin()
+	case file.IsArchive(input):
+		if info, statErr := os.Stat(input); statErr != nil || info.IsDir() {
+			return input
+		}
+		file.Input, err = file.OpenArchive(input)
+		if err == nil {
+			input = archiveRoot()
+		}
+	default:
+		return input
+	}
+	if err != nil {
+		fmt.Println(color.RedString("Could not read:"), input, err)
+		os.Exit(1)
+	}
+	return input
+}
+
+// archiveRoot returns where the document is in an archive: its publican.cfg,
+// or the directory holding it, looking in the top level and then in the one
+// directory an archive of a single directory has.
+func archiveRoot() string {
+	if batch {
+		return "."
+	}
+	if file.Exists("publican.cfg") {
+		return "publican.cfg"
+	}
+	entries, _ := file.ReadDir(".")
+	if len(entries) == 1 && entries[0].IsDir() {
+		if cfg := entries[0].Name() + "/publican.cfg"; file.Exists(cfg) {
+			return cfg
+		}
+		return entries[0].Name()
+	}
+	return "."
+}
+
+// closeOutput finishes writing the output archive, if there is one.
+func closeOutput() {
+	if err := file.Output.Close(); err != nil {
+		fmt.Println(color.RedString("Could not write:"), err)
+		os.Exit(1)
+	}
+}
+
+func readRules() []rule {
+	if rulesFile == "" {
+		return nil
+	}
+	b, err := file.ReadBytes(rulesFile)
+	if err != nil {
+		fmt.Println(color.RedString("Could not read:"), rulesFile, err)
+		os.Exit(1)
+	}
+	rules, err := parseRules(string(b), rulesFile)
+	if err != nil {
+		fmt.Println(color.RedString("Invalid rule:"), err)
+		os.Exit(1)
+	}
+	return rules
+}
+
+// load reads the document input names, which may be a publican.cfg, a
+// directory holding a document or the document itself. It returns nil if
+// there is no document there.
+func load(input string) *docBook.Doc {
 	db := docBook.NewFromPublicanCfg(input)
 	if db == nil {
 		db = docBook.NewFromDir(input)
@@ -55,13 +247,106 @@ func main() {
 	if db == nil {
 		db = docBook.NewFromFile(input)
 	}
-	if db == nil {
-		panic("file not found")
+	return db
+}
+
+// convert writes db, and the translations asked for, to output. It returns
+// the AsciiDoc of the document in its own language.
+func convert(db *docBook.Doc, input, output string, s translate.Style, rules []rule) *asciiDoc.Doc {
+	applyRules(db, rules)
+	if languages != "" && db.PublicanCfg != nil {
+		return convertLanguages(db, filepath.Dir(input), output, s)
+	}
+	var ids []string
+	if pot {
+		ids = po.Number(db.Data)
 	}
 	fmt.Print("Processing...\t")
-	ad := AsciiDocFromDocBook(db, s)
+	ad := translate.AsciiDocFromDocBook(db, s)
 	fmt.Println(" Complete.")
+	if output == "-" {
+		if len(ad.Resources) > 0 || len(ad.Books) > 0 || len(ad.Metadata) > 0 {
+			fmt.Println(color.YellowString("Not written to standard output:"), "resources, docinfo and the books of a set")
+		}
+		fmt.Fprintln(stdout, ad.Single())
+		log.Println("Complete")
+		return ad
+	}
 	ad.Write(output)
-	masterfile, _ := filepath.Abs(output + "/master.adoc")
+	if pot {
+		file.Write(output+"/po/master.pot", po.Write(ids, ad.Segments, nil, ""))
+	}
+	masterfile, _ := filepath.Abs(file.Destination(output + "/master.adoc"))
+	log.Println("Complete:", color.CyanString(masterfile))
+	return ad
+}
+
+// convertLanguages converts a Publican book and its PO translations into a
+// directory per language.
+func convertLanguages(db *docBook.Doc, dir, output string, s translate.Style) *asciiDoc.Doc {
+	source := db.PublicanCfg["xml_lang"]
+	langs := strings.Split(languages, ",")
+	if languages == "all" {
+		langs = po.Languages(dir, source)
+	}
+	var ids []string
+	if pot {
+		ids = po.Number(db.Data)
+	}
+	fmt.Print("Processing ", source, "...\t")
+	ad := translate.AsciiDocFromDocBook(db, s)
+	fmt.Println(" Complete.")
+	ad.Attributes["lang"] = source
+	ad.Write(output + "/" + source)
+	if pot {
+		file.Write(output+"/po/master.pot", po.Write(ids, ad.Segments, nil, ""))
+	}
+	var hint bool
+	for _, lang := range langs {
+		lang = strings.TrimSpace(lang)
+		if lang == "" || lang == source {
+			continue
+		}
+		cat := po.Load(dir + "/" + lang)
+		if len(cat) == 0 {
+			fmt.Println(color.RedString("No translations:"), lang)
+			continue
+		}
+		translated := docBook.New()
+		translated.PublicanCfg = db.PublicanCfg
+		translated.Resources = db.Resources
+		translated.Data = db.Data.Copy()
+		var r po.Report
+		cat.Translate(translated.Data, &r)
+		if poDetails {
+			for _, m := range r.Fuzzy {
+				fmt.Println(color.YellowString("Fuzzy ("+lang+"):"), m)
+			}
+			for _, m := range r.Untranslated {
+				fmt.Println(color.YellowString("Untranslated ("+lang+"):"), m)
+			}
+		}
+		fmt.Print("Processing ", lang, "...\t")
+		lad := translate.AsciiDocFromDocBook(translated, s)
+		fmt.Println(" Complete.")
+		lad.Attributes["lang"] = lang
+		lad.Write(output + "/" + lang)
+		if pot {
+			done := make(map[string]string)
+			for n := range r.Done {
+				done[n] = lad.Segments[n]
+			}
+			file.Write(output+"/po/"+lang+".po", po.Write(ids, ad.Segments, done, lang))
+		}
+		log.Printf("%s: %d messages, %d translated, %d fuzzy, %d untranslated", lang, r.Messages, r.Translated, len(r.Fuzzy), len(r.Untranslated))
+		if !poDetails && len(r.Fuzzy)+len(r.Untranslated) > 0 {
+			hint = true
+		}
+	}
+	if hint {
+		fmt.Println("Use -podetails to list the fuzzy and untranslated messages.")
+	}
+	masterfile, _ := filepath.Abs(file.Destination(output + "/" + source + "/master.adoc"))
 	log.Println("Complete:", color.CyanString(masterfile))
+	return ad
 }
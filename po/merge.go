@@ -0,0 +1,169 @@
+package po
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/clayts/docscii/file"
+	"github.com/clayts/docscii/xmlTree"
+)
+
+// messages are the elements Publican extracts as translatable messages.
+var messages = []string{"para", "simpara", "title", "subtitle", "titleabbrev", "term", "entry", "member", "screen", "programlisting", "literallayout", "synopsis", "address", "remark", "attribution", "bridgehead", "revremark", "refpurpose", "glossterm", "label"}
+
+// standaloneMessages are only messages when they are not within another one.
+var standaloneMessages = []string{"primary", "secondary", "tertiary", "see", "seealso", "phrase", "productname", "firstname", "surname", "othername", "orgname", "orgdiv", "contrib", "holder", "edition"}
+
+// placeholders are replaced with <placeholder-N/> in the message containing them
+// and translated separately.
+var placeholders = append([]string{"itemizedlist", "orderedlist", "variablelist", "simplelist", "note", "tip", "important", "caution", "warning", "figure", "table", "informaltable", "example", "informalexample", "mediaobject", "procedure", "footnote", "indexterm", "blockquote", "sidebar"}, messages...)
+
+type Report struct {
+	Messages     int
+	Translated   int
+	Fuzzy        []string
+	Untranslated []string
+	// Done holds the MESSAGE numbers (see Number) of translated messages.
+	Done map[string]bool
+}
+
+// Load returns a catalog of every PO file in dir and its subdirectories.
+func Load(dir string) Catalog {
+	cat := New()
+	file.Walk(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && filepath.Ext(path) == ".po" {
+			cat.Parse(file.Read(path))
+		}
+		return nil
+	})
+	return cat
+}
+
+// Languages returns the translations of a Publican book in dir, being the
+// subdirectories other than the source language that contain PO files.
+func Languages(dir, sourceLang string) []string {
+	var langs []string
+	dirs, err := file.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || d.Name() == sourceLang {
+			continue
+		}
+		files, _ := file.ReadDir(filepath.Join(dir, d.Name()))
+		for _, f := range files {
+			if !f.IsDir() && filepath.Ext(f.Name()) == ".po" {
+				langs = append(langs, d.Name())
+				break
+			}
+		}
+	}
+	return langs
+}
+
+// unit is a message element, its content with nested blocks replaced by
+// placeholders, and those nested blocks.
+type unit struct {
+	c    *xmlTree.Chunk
+	msg  xmlTree.Chunks
+	held xmlTree.Chunks
+	id   string
+}
+
+func split(c *xmlTree.Chunk) unit {
+	u := unit{c: c}
+	var text string
+	for _, ch := range c.Children {
+		if ch.IsKind(placeholders...) {
+			u.held = append(u.held, ch)
+			u.msg = append(u.msg, &xmlTree.Chunk{Kind: "placeholder-" + strconv.Itoa(len(u.held))})
+			continue
+		}
+		u.msg = append(u.msg, ch)
+		text += strings.TrimSpace(xmlTree.Chunks{ch}.Text())
+	}
+	if text != "" {
+		u.id = strings.Join(strings.Fields(serialise(u.msg)), " ")
+	}
+	return u
+}
+
+// walk calls fn for every message in cs.
+func walk(cs xmlTree.Chunks, fn func(unit)) {
+	for _, c := range cs {
+		if c.IsKind(messages...) || c.IsKind(standaloneMessages...) {
+			u := split(c)
+			walk(u.held, fn)
+			if u.id != "" {
+				fn(u)
+			}
+		} else {
+			walk(c.Children, fn)
+		}
+	}
+}
+
+// Number marks every message element in cs with a MESSAGE attribute holding
+// its index, which survives copying and translation, and returns the
+// messages in index order.
+func Number(cs xmlTree.Chunks) []string {
+	var ids []string
+	walk(cs, func(u unit) {
+		u.c.Attributes["MESSAGE"] = strconv.Itoa(len(ids))
+		ids = append(ids, u.id)
+	})
+	return ids
+}
+
+// IsPlaceholder reports whether c is translated separately from the message
+// containing it.
+func IsPlaceholder(c *xmlTree.Chunk) bool {
+	return c.IsKind(placeholders...)
+}
+
+// Translate replaces the messages in cs with their translations, leaving
+// untranslated and fuzzy messages in the source language.
+func (cat Catalog) Translate(cs xmlTree.Chunks, r *Report) {
+	walk(cs, func(u unit) {
+		r.Messages++
+		m, ok := cat[u.id]
+		switch {
+		case !ok || m.Str == "":
+			r.Untranslated = append(r.Untranslated, u.id)
+			return
+		case m.Fuzzy:
+			r.Fuzzy = append(r.Fuzzy, u.id)
+			return
+		}
+		r.Translated++
+		if r.Done == nil {
+			r.Done = make(map[string]bool)
+		}
+		r.Done[u.c.Attributes["MESSAGE"]] = true
+		translation := xmlTree.New(m.Str)
+		for _, p := range translation.Flatten() {
+			if !strings.HasPrefix(p.Kind, "placeholder-") {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimPrefix(p.Kind, "placeholder-"))
+			if err != nil || n < 1 || n > len(u.held) {
+				continue
+			}
+			siblings := translation
+			if p.Parent != nil {
+				siblings = p.Parent.Children
+			}
+			for i := range siblings {
+				if siblings[i] == p {
+					siblings[i] = u.held[n-1]
+					u.held[n-1].Parent = p.Parent
+				}
+			}
+		}
+		u.c.Children = nil
+		u.c.AddChildren(translation)
+	})
+}
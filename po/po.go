@@ -0,0 +1,122 @@
+package po
+
+import (
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/clayts/docscii/xmlTree"
+)
+
+type Message struct {
+	ID    string
+	Str   string
+	Fuzzy bool
+}
+
+// Catalog maps canonical message ids (see Canonical) to their messages.
+type Catalog map[string]Message
+
+func New() Catalog { return make(map[string]Message) }
+
+// unquote returns the contents of a quoted PO string.
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 1 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Parse adds the messages of a PO file to the catalog. Obsolete entries and
+// the header are ignored.
+func (cat Catalog) Parse(data string) {
+	var m Message
+	var field *string
+	flush := func() {
+		if m.ID != "" {
+			cat[Canonical(m.ID)] = m
+		}
+		m = Message{}
+		field = nil
+	}
+	for _, l := range strings.Split(data, "\n") {
+		l = strings.TrimSpace(l)
+		switch {
+		case l == "":
+			flush()
+		case strings.HasPrefix(l, "#,"):
+			if m.ID != "" || m.Str != "" {
+				flush()
+			}
+			for _, flag := range strings.Split(l[2:], ",") {
+				if strings.TrimSpace(flag) == "fuzzy" {
+					m.Fuzzy = true
+				}
+			}
+		case strings.HasPrefix(l, "#"):
+			// comments and obsolete entries
+		case strings.HasPrefix(l, "msgid "):
+			if m.ID != "" || m.Str != "" {
+				flush()
+			}
+			field = &m.ID
+			*field = unquote(strings.TrimPrefix(l, "msgid "))
+		case strings.HasPrefix(l, "msgstr "):
+			field = &m.Str
+			*field = unquote(strings.TrimPrefix(l, "msgstr "))
+		case strings.HasPrefix(l, "msgctxt ") || strings.HasPrefix(l, "msgid_plural ") || strings.HasPrefix(l, "msgstr["):
+			// plural forms and contexts are not used by Publican
+			field = nil
+		case strings.HasPrefix(l, "\"") && field != nil:
+			*field += unquote(l)
+		}
+	}
+	flush()
+}
+
+// Canonical returns a form of a message that does not depend on attribute
+// order, whitespace or escaping, so that messages from the tree and from PO
+// files can be compared.
+func Canonical(message string) string {
+	return strings.Join(strings.Fields(serialise(xmlTree.New(message))), " ")
+}
+
+func serialise(cs xmlTree.Chunks) string {
+	var output string
+	for _, c := range cs {
+		switch c.Kind {
+		case "TEXT":
+			if c.Attributes["REFERENCE"] != "" {
+				// Publican writes entity references as they are
+				output += "&" + c.Attributes["REFERENCE"] + ";"
+			} else {
+				output += html.EscapeString(c.Attributes["TEXT"])
+			}
+		case "DIRECTIVE", "PROCINST", "ENTITY", "COMMENT":
+		default:
+			var keys []string
+			for k := range c.Attributes {
+				// upper case attributes are docscii's own bookkeeping
+				if k != strings.ToUpper(k) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			output += "<" + c.Kind
+			for _, k := range keys {
+				output += " " + k + "=\"" + c.EscapeAttribute(k, html.EscapeString) + "\""
+			}
+			if len(c.Children) == 0 {
+				output += "/>"
+			} else {
+				output += ">" + serialise(c.Children) + "</" + c.Kind + ">"
+			}
+		}
+	}
+	return output
+}
@@ -0,0 +1,106 @@
+package po
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Catalog
+	}{
+		{
+			name: "header ignored",
+			data: "msgid \"\"\nmsgstr \"\"\n\"Content-Type: text/plain; charset=UTF-8\\n\"\n\nmsgid \"Hello\"\nmsgstr \"Hallo\"\n",
+			want: Catalog{"Hello": {ID: "Hello", Str: "Hallo"}},
+		},
+		{
+			name: "continued strings",
+			data: "msgid \"\"\n\"Sub \"\n\"a\"\nmsgstr \"\"\n\"Unter \"\n\"a\"\n",
+			want: Catalog{"Sub a": {ID: "Sub a", Str: "Unter a"}},
+		},
+		{
+			name: "fuzzy flag",
+			data: "#. Tag: para\n#, no-c-format, fuzzy\nmsgid \"A note.\"\nmsgstr \"Eine Notiz.\"\n",
+			want: Catalog{"A note.": {ID: "A note.", Str: "Eine Notiz.", Fuzzy: true}},
+		},
+		{
+			name: "entries without blank lines between them",
+			data: "msgid \"One\"\nmsgstr \"Eins\"\n#, fuzzy\nmsgid \"Two\"\nmsgstr \"Zwei\"\nmsgid \"Three\"\nmsgstr \"Drei\"\n",
+			want: Catalog{
+				"One":   {ID: "One", Str: "Eins"},
+				"Two":   {ID: "Two", Str: "Zwei", Fuzzy: true},
+				"Three": {ID: "Three", Str: "Drei"},
+			},
+		},
+		{
+			name: "escapes",
+			data: "msgid \"Say \\\"hi\\\"\\tnow\"\nmsgstr \"Sag \\\"hallo\\\"\\tjetzt\"\n",
+			want: Catalog{"Say &#34;hi&#34; now": {ID: "Say \"hi\"\tnow", Str: "Sag \"hallo\"\tjetzt"}},
+		},
+		{
+			name: "obsolete entries, contexts and plurals ignored",
+			data: "#~ msgid \"Old\"\n#~ msgstr \"Alt\"\n\nmsgctxt \"menu\"\nmsgid \"File\"\nmsgid_plural \"Files\"\nmsgstr[0] \"Datei\"\nmsgstr[1] \"Dateien\"\n",
+			want: Catalog{"File": {ID: "File"}},
+		},
+		{
+			name: "markup canonicalised",
+			data: "msgid \"Press <guibutton  b=\\\"2\\\" a=\\\"1\\\">OK</guibutton>\"\nmsgstr \"Drücken Sie <guibutton a=\\\"1\\\" b=\\\"2\\\">OK</guibutton>\"\n",
+			want: Catalog{"Press <guibutton a=\"1\" b=\"2\">OK</guibutton>": {ID: "Press <guibutton  b=\"2\" a=\"1\">OK</guibutton>", Str: "Drücken Sie <guibutton a=\"1\" b=\"2\">OK</guibutton>"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cat := New()
+			cat.Parse(tt.data)
+			if !reflect.DeepEqual(cat, tt.want) {
+				t.Errorf("Parse() = %#v, want %#v", cat, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"a  b\n c", "a b c"},
+		{"<x b=\"2\" a=\"1\"/>", "<x a='1' b='2'></x>"},
+		{"&amp; &lt;", "&amp;   &lt;"},
+		{"Use <emphasis role=\"strong\">it</emphasis>", "Use\n<emphasis  role='strong'>it</emphasis>"},
+	}
+	for _, tt := range tests {
+		if a, b := Canonical(tt.a), Canonical(tt.b); a != b {
+			t.Errorf("Canonical(%q) = %q, Canonical(%q) = %q", tt.a, a, tt.b, b)
+		}
+	}
+	// entity references are written as they are, and escaped text stays
+	// escaped
+	for in, want := range map[string]string{
+		"Use &PRODUCT; now":          "Use &PRODUCT; now",
+		"Write &amp;lt; for &lt;":    "Write &amp;lt; for &lt;",
+		"&amp;PRODUCT; &PRODUCT;":    "&amp;PRODUCT; &PRODUCT;",
+		`<ulink url="&URL;&amp;x"/>`: `<ulink url="&URL;&amp;x"/>`,
+	} {
+		if got := Canonical(in); got != want {
+			t.Errorf("Canonical(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWriteParse(t *testing.T) {
+	ids := []string{"<para>One</para>", "<para>Two</para>", "<para>Again</para>"}
+	source := map[string]string{"0": "One", "1": "Two\nlines", "2": "One"}
+	translated := map[string]string{"0": "Eins", "1": "Zwei\nZeilen"}
+	cat := New()
+	cat.Parse(Write(ids, source, translated, "de-DE"))
+	want := Catalog{
+		"One":       {ID: "One", Str: "Eins"},
+		"Two lines": {ID: "Two\nlines", Str: "Zwei\nZeilen"},
+	}
+	if !reflect.DeepEqual(cat, want) {
+		t.Errorf("Parse(Write()) = %#v, want %#v", cat, want)
+	}
+}
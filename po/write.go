@@ -0,0 +1,56 @@
+package po
+
+import (
+	"strconv"
+	"strings"
+)
+
+func poString(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) == 1 {
+		return strconv.Quote(s)
+	}
+	output := "\"\""
+	for _, l := range lines {
+		if l != "" {
+			output += "\n" + strconv.Quote(l)
+		}
+	}
+	return output
+}
+
+// Write returns a PO file whose messages are the AsciiDoc segments in source,
+// keyed by message number (see Number), with the DocBook message each came
+// from as an extracted comment. Translations are taken from translated, which
+// may be nil to write a template.
+func Write(ids []string, source, translated map[string]string, lang string) string {
+	output := "msgid \"\"\nmsgstr \"\"\n\"Content-Type: text/plain; charset=UTF-8\\n\"\n"
+	if lang != "" {
+		output += "\"Language: " + lang + "\\n\"\n"
+	}
+	var order []string
+	comments := make(map[string][]string)
+	strs := make(map[string]string)
+	for i, id := range ids {
+		n := strconv.Itoa(i)
+		seg, ok := source[n]
+		if !ok || strings.TrimSpace(seg) == "" {
+			continue
+		}
+		if _, ok := comments[seg]; !ok {
+			order = append(order, seg)
+		}
+		comments[seg] = append(comments[seg], id)
+		if t, ok := translated[n]; ok && strs[seg] == "" {
+			strs[seg] = t
+		}
+	}
+	for _, seg := range order {
+		output += "\n"
+		for _, id := range comments[seg] {
+			output += "#. DocBook: " + strings.Replace(id, "\n", " ", -1) + "\n"
+		}
+		output += "msgid " + poString(seg) + "\nmsgstr " + poString(strs[seg]) + "\n"
+	}
+	return output
+}
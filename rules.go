@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/clayts/docscii/docBook"
+	"github.com/clayts/docscii/xmlTree"
+
+	"github.com/fatih/color"
+)
+
+// A rule rewrites the DocBook elements matching a selector before they are
+// translated. Rules files hold one rule per line:
+//
+//	selector => action argument
+//
+// where the selector is as described at xmlTree.Selector and the action is one
+// of:
+//
+//	rename kind           change the element's kind
+//	set name=value        set an attribute
+//	unset name            remove an attribute
+//	remove                remove the element and its contents
+//	unwrap                replace the element with its contents
+//	wrap kind|xml         put the element inside a new one
+//	replace xml           replace the element
+//	before xml            insert before the element
+//	after xml             insert after the element
+//	prepend xml           insert at the start of the element's contents
+//	append xml            insert at the end of the element's contents
+//
+// In the xml given to wrap and replace, <content/> marks where the element,
+// or for replace its contents, belong. Blank lines and lines starting with #
+// are ignored, and rules are applied in the order they are written.
+type rule struct {
+	source   string
+	selector *xmlTree.Selector
+	action   string
+	argument string
+	fragment xmlTree.Chunks
+}
+
+// rule actions and whether they take an argument
+var ruleActions = map[string]bool{
+	"rename":  true,
+	"set":     true,
+	"unset":   true,
+	"remove":  false,
+	"unwrap":  false,
+	"wrap":    true,
+	"replace": true,
+	"before":  true,
+	"after":   true,
+	"prepend": true,
+	"append":  true,
+}
+
+// contentSelector finds where wrap and replace put what they matched.
+var contentSelector = xmlTree.MustSelector("content")
+
+func parseRules(s, filename string) ([]rule, error) {
+	var rules []rule
+	for i, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		r := rule{source: filename + ":" + strconv.Itoa(i+1)}
+		fail := func(msg string) error {
+			return errors.New(r.source + ": " + msg)
+		}
+		lSplit := strings.SplitN(l, "=>", 2)
+		if len(lSplit) != 2 {
+			return nil, fail("expected selector => action")
+		}
+		sel, err := xmlTree.NewSelector(strings.TrimSpace(lSplit[0]))
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		r.selector = sel
+		action := strings.TrimSpace(lSplit[1])
+		if i := strings.IndexAny(action, " \t"); i > -1 {
+			r.action, r.argument = action[:i], strings.TrimSpace(action[i+1:])
+		} else {
+			r.action = action
+		}
+		takesArgument, ok := ruleActions[r.action]
+		if !ok {
+			return nil, fail("unknown action " + strconv.Quote(r.action))
+		}
+		if takesArgument && r.argument == "" {
+			return nil, fail(r.action + " needs an argument")
+		}
+		if !takesArgument && r.argument != "" {
+			return nil, fail(r.action + " takes no argument")
+		}
+		switch r.action {
+		case "set":
+			if !strings.Contains(r.argument, "=") {
+				return nil, fail("expected set name=value")
+			}
+		case "wrap":
+			if !strings.HasPrefix(r.argument, "<") {
+				r.argument = "<" + r.argument + "><content/></" + r.argument + ">"
+			}
+			fallthrough
+		case "replace", "before", "after", "prepend", "append":
+			r.fragment, err = xmlTree.Parse(r.argument)
+			if err != nil {
+				return nil, fail(err.Error())
+			}
+			if r.action == "wrap" && len(contentSelector.Select(r.fragment)) != 1 {
+				return nil, fail("wrap needs exactly one <content/>")
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// applyRules rewrites the document with each rule in turn.
+func applyRules(db *docBook.Doc, rules []rule) {
+	for _, r := range rules {
+		matches := r.selector.Select(db.Data)
+		fmt.Println("Rewriting\t", r.source, "("+strconv.Itoa(len(matches))+" matched)")
+		for _, c := range matches {
+			if err := r.apply(c); err != nil {
+				fmt.Println(color.YellowString("Rule skipped:"), r.source, err)
+			}
+		}
+	}
+}
+
+func (r rule) apply(c *xmlTree.Chunk) error {
+	switch r.action {
+	case "rename":
+		c.Kind = r.argument
+		return nil
+	case "set":
+		aSplit := strings.SplitN(r.argument, "=", 2)
+		c.Attributes[strings.TrimSpace(aSplit[0])] = strings.Trim(strings.TrimSpace(aSplit[1]), "\"'")
+		return nil
+	case "unset":
+		delete(c.Attributes, r.argument)
+		return nil
+	case "prepend":
+		return c.InsertChildren(0, r.fragment.Copy()...)
+	case "append":
+		return c.InsertChildren(-1, r.fragment.Copy()...)
+	}
+	if c.Parent == nil {
+		return errors.New("<" + c.Kind + "> is the document's root")
+	}
+	switch r.action {
+	case "remove":
+		c.Remove()
+	case "unwrap":
+		c.Unwrap()
+	case "before":
+		return c.InsertBefore(r.fragment.Copy()...)
+	case "after":
+		return c.InsertAfter(r.fragment.Copy()...)
+	case "wrap":
+		fragment := r.fragment.Copy()
+		if err := c.InsertBefore(fragment...); err != nil {
+			return err
+		}
+		return contentSelector.Select(fragment)[0].Replace(c)
+	case "replace":
+		fragment := r.fragment.Copy()
+		if err := c.InsertBefore(fragment...); err != nil {
+			return err
+		}
+		for _, ch := range contentSelector.Select(fragment) {
+			if err := ch.Replace(c.Children.Copy()...); err != nil {
+				return err
+			}
+		}
+		c.Remove()
+	}
+	return nil
+}
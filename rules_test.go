@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clayts/docscii/docBook"
+	"github.com/clayts/docscii/xmlTree"
+)
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		rules string
+		want  string
+	}{
+		{"para", "r:1: expected selector => action"},
+		{"\n# comment\npara =>", "r:3: unknown action \"\""},
+		{"para => frob", "unknown action \"frob\""},
+		{"para[ => remove", "r:1: selector \"para[\""},
+		{"> para => remove", "misplaced >"},
+		{"para => rename", "rename needs an argument"},
+		{"para => remove now", "remove takes no argument"},
+		{"para => unwrap x", "unwrap takes no argument"},
+		{"para => set role", "expected set name=value"},
+		{"para => wrap <a><b/></a>", "wrap needs exactly one <content/>"},
+		{"para => wrap <a><content/><content/></a>", "wrap needs exactly one <content/>"},
+		{"para => before <a>", "r:1: "},
+		{"para => remove\npara => append <b></c>", "r:2: "},
+	}
+	for _, tt := range tests {
+		_, err := parseRules(tt.rules, "r")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseRules(%q) error = %v, want %q", tt.rules, err, tt.want)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := parseRules(`
+# rewrite the admonitions
+note[@role='x'] => rename warning
+  para, simpara =>   set role = "lead"
+listitem > para[1] => unwrap
+step[last()] => wrap orderedlist
+literal => wrap <phrase role="code"><content/></phrase>
+`, "r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		source, action, argument, fragment string
+	}{
+		{"r:3", "rename", "warning", ""},
+		{"r:4", "set", `role = "lead"`, ""},
+		{"r:5", "unwrap", "", ""},
+		{"r:6", "wrap", "<orderedlist><content/></orderedlist>", "<orderedlist><content/></orderedlist>"},
+		{"r:7", "wrap", `<phrase role="code"><content/></phrase>`, `<phrase role="code"><content/></phrase>`},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("parseRules() returned %d rules, want %d", len(rules), len(want))
+	}
+	for i, r := range rules {
+		w := want[i]
+		if r.source != w.source || r.action != w.action || r.argument != w.argument || r.fragment.XML() != w.fragment {
+			t.Errorf("rule %d = %s %s %q %q, want %s %s %q %q", i, r.source, r.action, r.argument, r.fragment.XML(), w.source, w.action, w.argument, w.fragment)
+		}
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	const doc = `<book><chapter id="c"><title>T</title><para role="a">One <b>two</b></para><para>Three</para></chapter></book>`
+	// chapter returns the chapter as it would be written with contents
+	chapter := func(contents string) string {
+		return `<book><chapter id="c">` + contents + `</chapter></book>`
+	}
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"rename", "para => rename simpara", chapter(`<title>T</title><simpara role="a">One <b>two</b></simpara><simpara>Three</simpara>`)},
+		{"set", "para => set role=x", chapter(`<title>T</title><para role="x">One <b>two</b></para><para role="x">Three</para>`)},
+		{"unset", "para => unset role", chapter(`<title>T</title><para>One <b>two</b></para><para>Three</para>`)},
+		{"remove", "para[@role] => remove", chapter(`<title>T</title><para>Three</para>`)},
+		{"unwrap", "para[1] => unwrap", chapter(`<title>T</title>One <b>two</b><para>Three</para>`)},
+		{"wrap in a kind", "title => wrap info", chapter(`<info><title>T</title></info><para role="a">One <b>two</b></para><para>Three</para>`)},
+		{"wrap in xml", `b => wrap <phrase role="r"><content/></phrase>`, chapter(`<title>T</title><para role="a">One <phrase role="r"><b>two</b></phrase></para><para>Three</para>`)},
+		{"replace", "b => replace <emphasis><content/></emphasis>", chapter(`<title>T</title><para role="a">One <emphasis>two</emphasis></para><para>Three</para>`)},
+		{"before", "para[last()] => before <note/>", chapter(`<title>T</title><para role="a">One <b>two</b></para><note/><para>Three</para>`)},
+		{"after", "title => after <subtitle>S</subtitle>", chapter(`<title>T</title><subtitle>S</subtitle><para role="a">One <b>two</b></para><para>Three</para>`)},
+		{"prepend", "para[last()] => prepend <b>0</b>", chapter(`<title>T</title><para role="a">One <b>two</b></para><para><b>0</b>Three</para>`)},
+		{"append", "chapter => append <para>End</para>", chapter(`<title>T</title><para role="a">One <b>two</b></para><para>Three</para><para>End</para>`)},
+		{"nothing matched", "note => remove", doc},
+		{"root", "book => unwrap\nbook => remove\nbook => wrap set\nbook => after <x/>", doc},
+		{"root contents", "book => prepend <x/>", `<book><x/><chapter id="c"><title>T</title><para role="a">One <b>two</b></para><para>Three</para></chapter></book>`},
+		{"in turn", "para => wrap <x><content/></x>\nx > para => unwrap", chapter(`<title>T</title><x>One <b>two</b></x><x>Three</x>`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseRules(tt.rules, "r")
+			if err != nil {
+				t.Fatal(err)
+			}
+			db := &docBook.Doc{Data: xmlTree.New(doc)}
+			applyRules(db, rules)
+			if got := db.Data.XML(); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyToRoot(t *testing.T) {
+	for _, action := range []string{"remove", "unwrap", "wrap x", "replace <x/>", "before <x/>", "after <x/>"} {
+		rules, err := parseRules("book => "+action, "r")
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := xmlTree.New(`<book/>`)[0]
+		if err := rules[0].apply(root); err == nil || err.Error() != "<book> is the document's root" {
+			t.Errorf("%s: apply() error = %v", action, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package translate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clayts/docscii/docBook"
+)
+
+// BenchmarkTranslate times the translation of synthetic books of increasing
+// size, each chapter holding benchSections sections:
+//
+//	go test -run - -bench Translate ./translate
+//
+// The ns/chapter should stay roughly level as the book grows; if it climbs
+// with the size, something has gone quadratic.
+func BenchmarkTranslate(b *testing.B) {
+	for _, n := range []int{10, 40, 160} {
+		b.Run(strconv.Itoa(n)+"chapters", func(b *testing.B) {
+			db := docBook.NewFromFile(generateBook(b, b.TempDir(), n))
+			if db == nil || len(db.Errors) > 0 {
+				b.Fatal("could not load the generated book")
+			}
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				AsciiDocFromDocBook(db)
+			}
+			b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*n), "ns/chapter")
+		})
+	}
+}
+
+const (
+	benchSections = 10
+	benchEntities = 200
+)
+
+const benchDoctype = `<?xml version='1.0' encoding='utf-8' ?>
+<!DOCTYPE %s PUBLIC "-//OASIS//DTD DocBook XML V4.5//EN" "http://www.oasis-open.org/docbook/xml/4.5/docbookx.dtd" [
+<!ENTITY %% BOOK_ENTITIES SYSTEM "Bench.ent">
+%%BOOK_ENTITIES;
+]>
+`
+
+func benchEntityFile() string {
+	var output strings.Builder
+	output.WriteString("<!ENTITY PRODUCT \"Bench Product\">\n")
+	for i := 0; i < benchEntities; i++ {
+		fmt.Fprintf(&output, "<!ENTITY ENT%d \"Entity %d\">\n", i, i)
+	}
+	return output.String()
+}
+
+func benchSection(ch, s int) string {
+	var output strings.Builder
+	id := fmt.Sprintf("sect-%d-%d", ch, s)
+	ent := fmt.Sprintf("&ENT%d;", (ch*benchSections+s)%benchEntities)
+	fmt.Fprintf(&output, "\t<section id=%q>\n\t\t<title>Section %d.%d</title>\n", id, ch, s)
+	for p := 0; p < 5; p++ {
+		fmt.Fprintf(&output, "\t\t<para>Run <command>tool --option %d</command> on %s to change <filename>/etc/bench/%d.conf</filename>. "+
+			"This is <emphasis>important</emphasis>, see <xref linkend=\"sect-%d-0\" /> and <ulink url=\"https://example.com/%d\">the site</ulink>. "+
+			"Press <keycombo><keycap>Ctrl</keycap><keycap>C</keycap></keycombo> or choose <guibutton>OK</guibutton>.</para>\n", p, ent, p, ch, p)
+	}
+	output.WriteString("\t\t<itemizedlist>\n")
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&output, "\t\t\t<listitem><para>Item %d with <literal>value_%d</literal>.</para>", i, i)
+		if i%3 == 0 {
+			fmt.Fprintf(&output, "<orderedlist><listitem><para>Nested %d.</para></listitem><listitem><para>Nested again.</para></listitem></orderedlist>", i)
+		}
+		output.WriteString("</listitem>\n")
+	}
+	output.WriteString("\t\t</itemizedlist>\n")
+	fmt.Fprintf(&output, "\t\t<screen>$ <command>bench</command> <replaceable>%s</replaceable> --count=%d\n", ent, s)
+	for i := 0; i < 8; i++ {
+		fmt.Fprintf(&output, "line %d of output for <userinput>%s</userinput>\n", i, id)
+	}
+	output.WriteString("</screen>\n")
+	output.WriteString("\t\t<note><para>A note about " + ent + ".</para></note>\n")
+	output.WriteString("\t\t<table><title>Values</title><tgroup cols=\"3\"><thead><row><entry>Name</entry><entry>Value</entry><entry>Meaning</entry></row></thead><tbody>\n")
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&output, "\t\t\t<row><entry><literal>n%d</literal></entry><entry>%d</entry><entry>Meaning of %s</entry></row>\n", i, i, ent)
+	}
+	output.WriteString("\t\t</tbody></tgroup></table>\n")
+	output.WriteString("\t\t<variablelist><varlistentry><term><option>--bench</option></term><listitem><para>Benchmarks " + ent + ".</para></listitem></varlistentry></variablelist>\n")
+	output.WriteString("\t</section>\n")
+	return output.String()
+}
+
+func benchChapter(ch int) string {
+	var output strings.Builder
+	fmt.Fprintf(&output, benchDoctype, "chapter")
+	fmt.Fprintf(&output, "<chapter id=\"chap-%d\">\n\t<title>Chapter %d</title>\n\t<para>An introduction to chapter %d of &PRODUCT;.</para>\n", ch, ch, ch)
+	for s := 0; s < benchSections; s++ {
+		output.WriteString(benchSection(ch, s))
+	}
+	output.WriteString("</chapter>\n")
+	return output.String()
+}
+
+// generateBook writes a book of n chapters into dir and returns its master
+// file.
+func generateBook(tb testing.TB, dir string, n int) string {
+	lang := filepath.Join(dir, "en-US")
+	if err := os.MkdirAll(lang, 0777); err != nil {
+		tb.Fatal(err)
+	}
+	write := func(name, contents string) {
+		if err := ioutil.WriteFile(filepath.Join(lang, name), []byte(contents), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	write("Bench.ent", benchEntityFile())
+	var master strings.Builder
+	fmt.Fprintf(&master, benchDoctype, "book")
+	master.WriteString("<book>\n\t<bookinfo id=\"book-Bench\">\n\t\t<title>Bench</title>\n\t\t<productname>&PRODUCT;</productname>\n\t</bookinfo>\n")
+	for ch := 0; ch < n; ch++ {
+		name := "Chapter_" + strconv.Itoa(ch) + ".xml"
+		write(name, benchChapter(ch))
+		fmt.Fprintf(&master, "\t<xi:include href=%q xmlns:xi=\"http://www.w3.org/2001/XInclude\" />\n", name)
+	}
+	master.WriteString("</book>\n")
+	write("Bench.xml", master.String())
+	return filepath.Join(lang, "Bench.xml")
+}
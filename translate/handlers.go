@@ -0,0 +1,987 @@
+package translate
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/clayts/docscii/asciiDoc"
+	"github.com/clayts/docscii/docBook"
+	"github.com/clayts/docscii/file"
+	"github.com/clayts/docscii/xmlTree"
+
+	"github.com/fatih/color"
+)
+
+// A Handler renders a DocBook element as AsciiDoc.
+type Handler func(t *Translator, c *xmlTree.Chunk) string
+
+// handlers holds the handlers registered for each kind of element, which take
+// precedence over docscii's own.
+var handlers = make(map[string]Handler)
+
+// RegisterHandler makes h render every element of the given kind in place of
+// docscii's own handling, which h may still call on with t.Builtin(c).
+func RegisterHandler(kind string, h Handler) {
+	handlers[kind] = h
+}
+
+type builtinHandler struct {
+	match  func(t *Translator, c *xmlTree.Chunk) bool
+	handle Handler
+}
+
+// builtinHandlers are tried in order, so that handlers for elements chosen by
+// style, such as templates and admonitions, come before those for their kind.
+var builtinHandlers []builtinHandler
+
+func kinds(ks ...string) func(t *Translator, c *xmlTree.Chunk) bool {
+	return func(t *Translator, c *xmlTree.Chunk) bool { return c.IsKind(ks...) }
+}
+
+// category matches the elements listed in a style category.
+func category(name string) func(t *Translator, c *xmlTree.Chunk) bool {
+	return func(t *Translator, c *xmlTree.Chunk) bool { return c.IsKind(t.Style[name]...) }
+}
+
+func (t *Translator) isTemplated(c *xmlTree.Chunk) bool { return t.Style.hasTemplate(c) }
+
+func (t *Translator) isAdmonition(c *xmlTree.Chunk) bool {
+	return t.Style.admonition(c) != "" || c.IsKind("example", "informalexample")
+}
+
+func (t *Translator) isSetMember(c *xmlTree.Chunk) bool {
+	return c.IsKind("book", "article") && t.within(c, "set")
+}
+
+func (t *Translator) isOmittedInclude(c *xmlTree.Chunk) bool {
+	return c.IsKind("include") && strings.HasPrefix(c.Attributes["href"], "Common_Content/") && len(t.Style["commoncontent"]) > 0 && t.Style["commoncontent"][0] == "omit"
+}
+
+func (t *Translator) isRolePhrase(c *xmlTree.Chunk) bool {
+	return c.IsKind("phrase") && t.Style.role(c) != "" && !t.within(c, "textobject")
+}
+
+func (t *Translator) isHighlighted(c *xmlTree.Chunk) bool {
+	return c.IsKind(t.Style["highlight"]...) || c.IsKind(t.unquoted...)
+}
+
+func init() {
+	builtinHandlers = []builtinHandler{
+		{kinds("ENTITY"), (*Translator).entity},
+		{kinds("TEXT"), (*Translator).text},
+		{kinds("COMMENT"), (*Translator).comment},
+		{kinds("PROCINST"), (*Translator).procinst},
+		{(*Translator).isTemplated, (*Translator).templated},
+		{(*Translator).isAdmonition, (*Translator).admonition},
+		{kinds("sidebar"), (*Translator).sidebar},
+		{kinds("blockquote", "epigraph"), (*Translator).blockquote},
+		{kinds("literallayout", "address"), (*Translator).literallayout},
+		{kinds("variablelist", "itemizedlist", "orderedlist", "bibliolist", "figure", "table"), (*Translator).list},
+		{kinds("ulink"), (*Translator).ulink},
+		{kinds("xref", "link"), (*Translator).xref},
+		{kinds("screen", "synopsis", "programlisting"), (*Translator).screen},
+		{category("paragraphs"), (*Translator).para},
+		{kinds("abstract"), (*Translator).abstract},
+		{kinds("imagedata"), (*Translator).imagedata},
+		{kinds("mediaobject"), (*Translator).mediaobject},
+		{kinds("inlinemediaobject"), (*Translator).inlinemediaobject},
+		{kinds("tgroup"), (*Translator).tgroup},
+		{kinds("row"), (*Translator).row},
+		{kinds("entry"), (*Translator).entry},
+		{kinds("footnote"), (*Translator).footnote},
+		{(*Translator).isSetMember, (*Translator).setMember},
+		{kinds("set", "book", "article"), (*Translator).document},
+		{kinds("bookinfo", "articleinfo", "setinfo"), (*Translator).info},
+		{kinds("bridgehead"), (*Translator).bridgehead},
+		{kinds("chapter", "section", "part", "appendix", "preface"), (*Translator).section},
+		{(*Translator).isOmittedInclude, (*Translator).omittedInclude},
+		{kinds("include"), (*Translator).include},
+		{kinds("procedure", "formalpara"), (*Translator).procedure},
+		{kinds("varlistentry"), (*Translator).varlistentry},
+		{kinds("corpauthor", "pubdate", "biblioid"), (*Translator).corpauthor},
+		{category("listitems"), (*Translator).listitem},
+		{kinds("revhistory"), (*Translator).revhistory},
+		{kinds("affiliation"), (*Translator).affiliation},
+		{kinds("author", "editor"), (*Translator).author},
+		{kinds("term"), (*Translator).term},
+		{(*Translator).isRolePhrase, (*Translator).rolePhrase},
+		{kinds("title", "phrase", "date", "firstname", "surname", "orgdiv", "email", "textobject", "primary", "secondary", "tertiary", "seealso", "see"), (*Translator).trimmed},
+		{category("monospace"), (*Translator).monospace},
+		{category("superscript"), (*Translator).superscript},
+		{category("italics"), (*Translator).italic},
+		{category("bold"), (*Translator).bold},
+		{(*Translator).isHighlighted, (*Translator).highlight},
+		{kinds("indexterm"), (*Translator).indexterm},
+		{kinds("quote"), (*Translator).quotation},
+		{kinds("manvolnum"), (*Translator).manvolnum},
+		{kinds("guibutton"), (*Translator).guibutton},
+		{kinds("menuchoice"), (*Translator).menuchoice},
+		{kinds("keycap"), (*Translator).keycap},
+		{kinds("keycombo"), (*Translator).keycombo},
+		{kinds("guimenu", "guisubmenu", "optional", "productnumber", "edition", "pubsnumber"), (*Translator).contents},
+		{kinds("remark"), (*Translator).remark},
+		{kinds("keyword", "subjectterm"), (*Translator).keyword},
+	}
+}
+
+func (t *Translator) entity(c *xmlTree.Chunk) string {
+	var output string
+	contents := replaceReferences(t.Translate(c.Children), func(name string) (string, bool) {
+		v, ok := t.Doc.Entities[name]
+		return v, ok
+	})
+	ref := "&" + c.Attributes["KEY"] + ";"
+	for k, v := range t.Doc.Entities {
+		if strings.Contains(v, ref) {
+			t.Doc.Entities[k] = strings.Replace(v, ref, contents, -1)
+		}
+	}
+	t.Doc.Entities[c.Attributes["KEY"]] = contents
+	return output
+}
+
+func (t *Translator) text(c *xmlTree.Chunk) string {
+	delete(t.register, c)
+	return c.Attributes["TEXT"]
+}
+
+func (t *Translator) procinst(c *xmlTree.Chunk) string {
+	var output string
+	target := c.Attributes["TARGET"]
+	if snippet, ok := t.Style.procinst(target); ok {
+		// verbatim blocks have no way to express them
+		if !t.within(c, t.Style["literal"]...) && !t.within(c, "literallayout", "address") {
+			snippet = strings.Replace(snippet, "{text}", strings.TrimSpace(c.Attributes["INSTRUCTION"]), -1)
+			if !t.within(c, t.Style["paragraphs"]...) && !t.within(c, "title", "term", "entry") && !strings.HasPrefix(snippet, "\n") {
+				snippet = "\n\n" + snippet + "\n"
+			}
+			output += snippet
+		}
+	} else if target != "xml" && target != "xml-stylesheet" && target != "xml-model" && target != "dbhtml" && target != "dbfo" {
+		// dbhtml and dbfo hints are read by the elements they belong to
+		t.warn(color.YellowString("Unknown:"), c.XML())
+		t.Doc.Unknown["<?"+target+"?>"]++
+	}
+	return output
+}
+
+func (t *Translator) templated(c *xmlTree.Chunk) string {
+	var output string
+	open, close, _ := t.Style.template(c)
+	templated := false
+	for _, a := range c.Ancestors() {
+		if aOpen, aClose, ok := t.Style.template(a); ok && aOpen == open && aClose == close {
+			templated = true
+			break
+		}
+	}
+	if templated {
+		output += t.Translate(c.Children)
+	} else {
+		output += t.quote(c, open, close)
+	}
+	return output
+}
+
+func (t *Translator) admonition(c *xmlTree.Chunk) string {
+	var output string
+	admonition := strings.ToUpper(t.Style.admonition(c))
+	body := c.Children.FilterOut("TEXT", "title")
+	if c.IsKind(t.Style["paragraphs"]...) {
+		body = nil
+	}
+	content := body.FilterOut("COMMENT", "PROCINST")
+	var inline bool
+	for _, a := range t.Style["inlineadmonitions"] {
+		if admonition != "" && strings.ToUpper(a) == admonition {
+			inline = !c.Children.Contains("title") && (body == nil || len(content) == 1 && content[0].IsKind(t.Style["paragraphs"]...))
+		}
+	}
+	output += t.decorateTitle(c, ".")
+	if inline {
+		if body != nil {
+			// an in-line admonition holds a single paragraph, so comments go before it
+			output += decorateIfNotBlank(strings.TrimSpace(t.Translate(body.Filter("COMMENT", "PROCINST"))), "\n", "")
+			output += "\n" + admonition + ": " + t.paragraph(content[0]) + "\n"
+		} else {
+			output += "\n" + admonition + ": " + t.paragraph(c) + "\n"
+		}
+	} else {
+		decor := "\n===="
+		for _, a := range c.Ancestors() {
+			if t.Style.admonition(a) != "" || a.IsKind("example", "informalexample") {
+				decor += "="
+			}
+		}
+		decor += "\n"
+		if admonition != "" {
+			output += "\n[" + admonition + "]"
+		}
+		if body == nil {
+			output += decor + t.paragraph(c) + decor
+		} else {
+			output += decor + t.Translate(body) + decor
+		}
+	}
+	return output
+}
+
+func (t *Translator) sidebar(c *xmlTree.Chunk) string {
+	var output string
+	decor := "\n****"
+	for range c.Ancestors().Filter("sidebar") {
+		decor += "*"
+	}
+	decor += "\n"
+	output += t.decorateTitle(c, ".")
+	output += decor + t.Translate(c.Children.FilterOut("TEXT", "title")) + decor
+	return output
+}
+
+func (t *Translator) blockquote(c *xmlTree.Chunk) string {
+	var output string
+	attribution := c.Children.First("attribution")
+	var attr []string
+	if attribution != nil {
+		source := strings.TrimSpace(t.Translate(attribution.Children.Filter("citetitle").Children()))
+		// the punctuation separating the author from the title is left out
+		attr = append(attr, strings.TrimRight(strings.TrimSpace(t.Translate(attribution.Children.FilterOut("citetitle"))), ",;: \t\n"))
+		if source != "" {
+			attr = append(attr, source)
+		}
+	}
+	style := "quote"
+	if c.IsKind("epigraph") {
+		style += ".epigraph"
+	}
+	for i, a := range attr {
+		if strings.ContainsAny(a, ",\"") {
+			attr[i] = "\"" + strings.Replace(a, "\"", "\\\"", -1) + "\""
+		}
+	}
+	decor := "\n____"
+	for range c.Ancestors().Filter("blockquote", "epigraph") {
+		decor += "_"
+	}
+	decor += "\n"
+	output += t.decorateTitle(c, ".")
+	output += "\n[" + strings.Join(append([]string{style}, attr...), ", ") + "]"
+	output += decor + t.Translate(c.Children.FilterOut("TEXT", "title", "attribution")) + decor
+	return output
+}
+
+func (t *Translator) literallayout(c *xmlTree.Chunk) string {
+	var output string
+	contents := strings.TrimSuffix(strings.TrimPrefix(t.Translate(c.Children), "\n"), "\n")
+	if c.Parent != nil && c.Parent.IsKind(t.Style["paragraphs"]...) {
+		output += "\n"
+	}
+	output += t.decorateTitle(c, ".")
+	if c.Attributes["class"] == "monospaced" {
+		output += "\n....\n" + contents + "\n....\n"
+	} else {
+		output += "\n[verse]\n____\n" + contents + "\n____\n"
+	}
+	return output
+}
+
+func (t *Translator) list(c *xmlTree.Chunk) string {
+	var output string
+	output += decorateIfNotBlank(t.decorateTitle(c, "."), "", "\n")
+	output += decorateIfNotBlank(listAttributes(t.Data, c), "[", "]")
+	if c.IsKind("orderedlist") && c.Attributes["inheritnum"] == "inherit" {
+		// AsciiDoc has no way to prefix items with their parent's number
+		t.warn(color.YellowString("Unsupported:"), `<orderedlist inheritnum="inherit">`+decorateIfNotBlank(c.Attributes["id"], " (", ")"), "is numbered on its own")
+	}
+	output += t.Translate(c.Children.FilterOut("TEXT", "title"))
+	return output
+}
+
+func (t *Translator) ulink(c *xmlTree.Chunk) string {
+	var output string
+	url := c.Attributes["url"]
+	if cc := c.Children.First(t.Style["custom"]...); cc != nil {
+		text := t.Translate(c.Children.Flatten().Filter("TEXT"))
+		fake := &xmlTree.Chunk{}
+		fake.Kind = cc.Kind
+		ftext := &xmlTree.Chunk{}
+		ftext.Kind = "TEXT"
+		ftext.Attributes = make(map[string]string)
+		ftext.Attributes["TEXT"] = "link:++" + url + "++[" + text + "]"
+		fake.Children = append(fake.Children, ftext)
+		output += t.Translate(xmlTree.Chunks{fake})
+	} else {
+		output += "link:++" + url + "++[" + t.Translate(c.Children) + "]"
+	}
+	return output
+}
+
+func (t *Translator) xref(c *xmlTree.Chunk) string {
+	var output string
+	link := c.Attributes["linkend"]
+	output += "<<" + link + decorateIfNotBlank(t.Translate(c.Children), ",", "") + ">>"
+	return output
+}
+
+func (t *Translator) screen(c *xmlTree.Chunk) string {
+	var output string
+	if c.Parent.IsKind(t.Style["paragraphs"]...) {
+		output += "\n"
+	}
+	var subs []string
+
+	var escapeLtGt bool
+	if t.quoteSafe(xmlTree.Chunks{c}) {
+		subs = append(subs, "quotes")
+		escapeLtGt = true
+	}
+	children := t.Translate(c.Children)
+	if strings.Contains(children, "pass:") || c.Children.Flatten().Contains("ulink") {
+		subs = append(subs, "macros")
+		escapeLtGt = true
+	}
+	if escapeLtGt {
+		children = strings.Replace(children, "<", "&lt;", -1)
+		children = strings.Replace(children, ">", "&gt;", -1)
+	}
+	if hasReference(children, t.Doc.Entities) {
+		subs = append(subs, "attributes")
+	}
+	if len(subs) > 0 {
+		output += "\n[subs=\"" + strings.Join(subs, ", ") + "\"]"
+	}
+
+	output += "\n----\n" + children + "\n----\n"
+	return output
+}
+
+func (t *Translator) para(c *xmlTree.Chunk) string {
+	var output string
+	children := t.paragraph(c)
+	role := t.Style.role(c)
+	if c.Parent != nil && c.Parent.IsKind(t.Style["listitems"]...) && c.Parent.Children.FilterOut("TEXT", "COMMENT", "PROCINST")[0] == c {
+		// a list item's principal text cannot carry block attributes
+		role = ""
+	}
+	output += "\n" + decorateIfNotBlank(role, "[.", "]\n") + children + "\n"
+	return output
+}
+
+func (t *Translator) abstract(c *xmlTree.Chunk) string {
+	var output string
+	output += t.decorateTitle(c, ".")
+	output += "\n[abstract]\n--\n" + t.Translate(c.Children.FilterOut("TEXT", "title")) + "\n--\n"
+	return output
+}
+
+func (t *Translator) imagedata(c *xmlTree.Chunk) string {
+	var output string
+	if href, ok := c.Attributes["fileref"]; ok {
+		t.Doc.Resources[filepath.Clean(c.Attributes["DIR"]+"/"+href)] = t.Source.Resources[filepath.Clean(c.Attributes["DIR"]+"/"+href)]
+		output += href
+	}
+	return output
+}
+
+func (t *Translator) mediaobject(c *xmlTree.Chunk) string {
+	return "\nimage::" + t.Translate(c.Children.Filter("imageobject")) + "[" + t.Translate(c.Children.Filter("textobject")) + "]\n"
+}
+
+func (t *Translator) inlinemediaobject(c *xmlTree.Chunk) string {
+	return "\nimage:" + t.Translate(c.Children.Filter("imageobject")) + "[" + t.Translate(c.Children.Filter("textobject")) + "]"
+}
+
+func (t *Translator) tgroup(c *xmlTree.Chunk) string {
+	var output string
+	head := t.Translate(c.Children.Filter("thead"))
+	var options []string
+	if head != "" {
+		options = append(options, "header")
+	}
+	if len(options) > 0 {
+		output += "\n[options=\"" + strings.Join(options, ",") + "\"]"
+	}
+	foot := t.Translate(c.Children.Filter("tfoot"))
+
+	delim := "\n|===\n"
+	if t.nestedTable(c) {
+		delim = "\n!===\n"
+	}
+	output += delim[:len(delim)-1] + head + t.Translate(c.Children.FilterOut("TEXT", "thead", "tfoot")) + foot + delim
+	return output
+}
+
+func (t *Translator) row(c *xmlTree.Chunk) string {
+	return "\n" + t.Translate(c.Children.FilterOut("TEXT"))
+}
+
+func (t *Translator) entry(c *xmlTree.Chunk) string {
+	var output string
+	var maxLen int
+	if len(c.Parent.Children.Filter("entry")) == 1 {
+		tgroup := c.Ancestors().First("tgroup")
+		if tgroup == nil {
+			panic("entry outside tgroup")
+		}
+
+		for _, child := range tgroup.Children.Children().Filter("row") {
+			length := len(child.Children.Filter("entry"))
+			if length > maxLen {
+				maxLen = length
+			}
+		}
+		output += strconv.Itoa(maxLen) + "+"
+	}
+
+	sep := "|"
+	if t.nestedTable(c) {
+		sep = "!"
+	}
+	contents := strings.Replace(strings.TrimSpace(t.Translate(c.Children)), sep, "\\"+sep, -1)
+	if c.Children.Flatten().Contains("table", "informaltable") {
+		// AsciiDoc cells only hold tables of their own in the AsciiDoc style,
+		// and the table must start on a line of its own; so must the style,
+		// or it is taken for the previous cell's text
+		if c != c.Parent.Children.Filter("entry")[0] {
+			output += "\n"
+		}
+		output += "a" + sep + "\n" + contents + "\n"
+	} else {
+		output += sep + contents
+	}
+	return output
+}
+
+func (t *Translator) footnote(c *xmlTree.Chunk) string {
+	return "footnote:[" + strings.TrimSpace(t.Translate(c.Children)) + "]"
+}
+
+func (t *Translator) setMember(c *xmlTree.Chunk) string {
+	var output string
+	sub := asciiDoc.New()
+	sub.Docinfo = t.Doc.Docinfo
+	publicanAttributes(sub, t.Source.PublicanCfg)
+	for k, v := range t.Doc.Entities {
+		sub.Entities[k] = v
+	}
+	translateInto(sub, &docBook.Doc{PublicanCfg: t.Source.PublicanCfg, Resources: t.Source.Resources, Data: xmlTree.Chunks{c}}, t.Style)
+	n := len(t.Doc.Books) + 1
+	dir := bookDir(c, n)
+	// members sharing a title or id would otherwise overwrite each other
+	for base := dir; t.Doc.Books[dir] != nil; n++ {
+		dir = base + "-" + strconv.Itoa(n)
+	}
+	t.Doc.Books[dir] = sub
+	book := xmlTree.Chunks{c}
+	for _, ch := range book.Flatten() {
+		delete(t.register, ch)
+	}
+	title := strings.TrimSpace(t.plain(c.Children.Filter("title")))
+	if title == "" {
+		title = strings.TrimSpace(t.plain(c.Children.Filter("bookinfo", "articleinfo", "info").Children().Filter("title")))
+	}
+	output += "\n* xref:" + dir + "/master.adoc[" + title + "]\n"
+	return output
+}
+
+func (t *Translator) document(c *xmlTree.Chunk) string {
+	var output string
+	// the title is usually in the info element, which writes the header
+	if title := strings.TrimSpace(t.Translate(c.Children.Filter("title"))); title != "" {
+		output += "= " + title + t.header(c) + "\n"
+	}
+	output += t.Translate(c.Children.FilterOut("title", "TEXT"))
+	return output
+}
+
+func (t *Translator) info(c *xmlTree.Chunk) string {
+	var output string
+	output += decorateIfNotBlank(strings.TrimSpace(t.Translate(c.Children.Filter("title"))), "= ", "")
+	output += t.header(c)
+
+	children := t.infoChildren(c)
+	meta := children.Filter("productname", "productnumber", "subtitle", "abstract", "edition", "pubsnumber", "authorgroup", "legalnotice", "revhistory")
+	if authors := children.Filter("author", "editor", "corpauthor"); len(authors) > 0 {
+		group := &xmlTree.Chunk{Kind: "authorgroup"}
+		group.AddChildren(authors.Copy())
+		meta = append(meta, group)
+	}
+	if !meta.Contains("revhistory") {
+		if rh := t.Data.Flatten().First("revhistory"); rh != nil {
+			meta = append(meta, rh)
+		}
+	}
+	t.Doc.Metadata = append(t.Doc.Metadata, matchingConditions(meta, t.Source.PublicanCfg["condition"])...)
+	for _, ch := range children.Filter("productname", "productnumber", "subtitle", "abstract", "edition", "pubsnumber").Flatten() {
+		delete(t.register, ch)
+	}
+
+	if legal := strings.TrimSpace(t.Translate(children.Filter("legalnotice").Children().FilterOut("TEXT", "title"))); legal != "" {
+		if len(t.Style["legalnotice"]) > 0 && t.Style["legalnotice"][0] == "preamble" {
+			output += "\n\n" + legal + "\n"
+		} else {
+			output += "\n\ninclude::" + t.create("legal-notice", legal) + "[]\n"
+		}
+	}
+
+	output += "\n" + t.Translate(children.FilterOut("title", "TEXT", "productname", "productnumber", "edition", "pubsnumber", "author", "editor", "corpauthor", "authorgroup", "copyright", "legalnotice"))
+	return output
+}
+
+func (t *Translator) bridgehead(c *xmlTree.Chunk) string {
+	return "\n." + strings.TrimSpace(t.Translate(c.Children))
+}
+
+func (t *Translator) section(c *xmlTree.Chunk) string {
+	var output string
+	titleDecor := "=="
+	if c.IsKind("part") {
+		// parts are level 0 sections in AsciiDoc books
+		titleDecor = "="
+	}
+	for _, ancestor := range c.Ancestors() {
+		if ancestor.Children.Contains("title") && !ancestor.IsKind("set", "book", "article", "part") {
+			titleDecor += "="
+		}
+	}
+	if len(titleDecor) > 6 {
+		titleDecor = "."
+	} else {
+		titleDecor += " "
+	}
+	if c.IsKind("appendix", "preface") && titleDecor != "." {
+		output += "\n\n[" + c.Kind + "]" + strings.TrimPrefix(t.decorateTitle(c, titleDecor), "\n")
+	} else {
+		output += t.decorateTitle(c, titleDecor)
+	}
+	output += "\n" + t.Translate(c.Children.FilterOut("title", "TEXT"))
+	return output
+}
+
+func (t *Translator) omittedInclude(c *xmlTree.Chunk) string {
+	return "\n// " + c.Attributes["href"] + " omitted\n"
+}
+
+func (t *Translator) include(c *xmlTree.Chunk) string {
+	var output string
+	if href, ok := c.Attributes["href"]; ok {
+		decor := "\n"
+		if t.within(c, t.Style["listitems"]...) && !t.within(c, t.Style["literal"]...) {
+			decor = "\n--\n"
+		}
+		if t.within(c, "mediaobject", "inlinemediaobject") {
+			output += t.Translate(c.Children)
+		} else {
+			if c.Attributes["parse"] == "text" {
+				if d, ok := t.Source.Resources[filepath.Clean(c.Attributes["DIR"]+"/"+href)]; ok {
+					t.Doc.Resources[filepath.Clean(c.Attributes["DIR"]+"/"+href)] = d
+					var attrs string
+					if enc := strings.ToLower(c.Attributes["encoding"]); enc != "" && enc != "utf-8" && enc != "utf8" {
+						attrs = "encoding=" + enc
+					}
+					output += decor + "include::" + href + "[" + attrs + "]" + decor
+				} else {
+					output += t.Translate(c.Children.Filter("fallback"))
+				}
+			} else {
+				newData := t.Translate(c.Children.FilterOut("fallback", "TEXT"))
+				if t.within(c, "set") && c.Children.Contains("book", "article") {
+					// set members have been written to their own directories
+					output += newData
+				} else if newData != "" {
+					output += decor + "include::" + t.create(file.StripExt(href), newData) + "[]" + decor
+				} else {
+					output += t.Translate(c.Children.Filter("fallback"))
+				}
+			}
+		}
+	}
+	return output
+}
+
+func (t *Translator) procedure(c *xmlTree.Chunk) string {
+	var output string
+	output += t.decorateTitle(c, ".")
+	output += t.Translate(c.Children.FilterOut("TEXT", "title"))
+	return output
+}
+
+func (t *Translator) varlistentry(c *xmlTree.Chunk) string {
+	return t.Translate(c.Children.FilterOut("TEXT", "term"))
+}
+
+func (t *Translator) corpauthor(c *xmlTree.Chunk) string {
+	var output string
+	var pre, suf string
+	if t.within(c, "biblioentry") {
+		pre = ", "
+	} else if t.within(c, "authorgroup") {
+		pre = "\n."
+		suf = "\n&blank;\n\n"
+	}
+	output += decorateIfNotBlank(strings.TrimSpace(t.Translate(c.Children)), pre, suf)
+	return output
+}
+
+func (t *Translator) listitem(c *xmlTree.Chunk) string {
+	var output string
+	var bullet string
+	switch c.Parent.Kind {
+	case "itemizedlist", "varlistentry", "bibliolist", "simplelist", "author", "stepalternatives":
+		bullet = "*"
+	default:
+		bullet = "."
+	}
+	// comments ahead of the principal text go before the bullet, as the
+	// text must follow it directly
+	rest := c.Children
+	var notes xmlTree.Chunks
+	for len(rest) > 0 && (rest[0].IsKind("COMMENT", "PROCINST") || rest[0].IsKind("TEXT") && strings.TrimSpace(rest[0].Attributes["TEXT"]) == "") {
+		if !rest[0].IsKind("TEXT") {
+			notes = append(notes, rest[0])
+		}
+		rest = rest[1:]
+	}
+	var children string
+	if c.IsKind("member", "contrib") {
+		children = strings.TrimSpace(t.Translate(rest))
+	} else {
+		children = strings.TrimSpace(t.Translate(rest.FilterOut("TEXT")))
+	}
+	lines := strings.Split(children, "\n")
+	var item strings.Builder
+
+	var blockDelimLength int
+	var blockDelimChar byte
+
+lineLoop:
+	for i, l := range lines {
+		if l == "" {
+			next := i + 1
+			for next < len(lines) && lines[next] == "" {
+				next++
+			}
+			if blockDelimLength == 0 && (next == len(lines) || !isListItem(lines[next])) {
+				item.WriteString("+")
+			}
+			item.WriteString("\n")
+			continue
+		}
+		item.WriteString(l + "\n")
+		if blockDelimLength == 0 {
+			if len(l) >= 4 &&
+				(l[0] == '-' ||
+					l[0] == '=' ||
+					l[0] == '/' ||
+					l[0] == '.' ||
+					l[0] == '+' ||
+					l[0] == '_' ||
+					l[0] == '*' ||
+					l[0] == '|') {
+				var delim byte
+				if l[0] == '|' {
+					delim = '='
+				} else {
+					delim = l[0]
+				}
+				for i := range l {
+					if delim != l[i] {
+						//not a delim
+						continue lineLoop
+					}
+				}
+				blockDelimLength = len(l)
+				blockDelimChar = l[0]
+			}
+		} else {
+			if len(l) == blockDelimLength && blockDelimChar == l[0] {
+				blockDelimLength = 0
+			}
+		}
+	}
+	p := item.String()
+	for strings.Contains(p, "\n+\n+\n") {
+		p = strings.Replace(p, "\n+\n+\n", "\n+\n", -1)
+	}
+	var itemDecor string
+
+	term := t.Translate(c.Parent.Children.Filter("term"))
+	if term != "" {
+		itemDecor = "\n" + term + ":"
+		for range c.Ancestors().Filter("varlistentry") {
+			itemDecor += ":"
+		}
+		itemDecor += " "
+	} else {
+		itemDecor = "\n" + bullet
+		for range c.Ancestors().Filter(t.Style["listitems"]...) {
+			itemDecor += bullet
+		}
+	}
+	if len(p) > 2 {
+		output += decorateIfNotBlank(strings.TrimSpace(t.Translate(notes)), "\n", "")
+
+		if p[len(p)-2:] == "+\n" {
+			p = p[:len(p)-2]
+		}
+
+		var bypassBrokenInclusionsed bool
+		for _, start := range "1234567890qwertyuiopasdfghjklzxcvbnmQWERTYUIOPASDFGHJKLZXCVBNM" {
+			if string(p[0]) == string(start) || string(p[1]) == string(start) || string(p[2]) == string(start) {
+				output += itemDecor + " " + p + "\n"
+				bypassBrokenInclusionsed = true
+				break
+			}
+		}
+		if !bypassBrokenInclusionsed {
+			output += itemDecor + " &blank;\n+\n" + p + "\n"
+		}
+	}
+	return output
+}
+
+func (t *Translator) revhistory(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, "bookinfo", "articleinfo") {
+		// the info element is rendered as the document header, so the
+		// history is moved to an appendix at the end of the document
+		t.revisionHistory += "\n\n[appendix]\n== Revision History\n" + t.renderRevhistory(c)
+	} else {
+		output += t.renderRevhistory(c)
+	}
+	return output
+}
+
+func (t *Translator) affiliation(c *xmlTree.Chunk) string {
+	var output string
+	orgname := t.Translate(c.Children.Filter("orgname"))
+	output += decorateIfNotBlank(orgname, "\n", "\n")
+	orgdiv := t.Translate(c.Children.Filter("orgdiv"))
+	if orgdiv != "" {
+		if orgname == "" {
+			output += "\n"
+		}
+		output += orgdiv + "\n"
+	}
+	return output
+}
+
+func (t *Translator) author(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, "authorgroup") {
+		fn := decorateIfNotBlank(t.Translate(c.Children.Filter("firstname")), "", " ")
+		output += "\n." + fn + t.Translate(c.Children.Filter("surname")) + "\n"
+		var content []string
+		affiliation := t.Translate(c.Children.Filter("affiliation"))
+		if affiliation != "" {
+			content = append(content, affiliation)
+		}
+
+		email := t.Translate(c.Children.Filter("email"))
+		if email != "" {
+			content = append(content, email)
+		}
+
+		contrib := t.Translate(c.Children.Filter("contrib"))
+		if contrib != "" {
+			content = append(content, contrib)
+		}
+
+		if len(content) == 0 {
+			output += "\n&blank;"
+		}
+		output += strings.Join(content, "\n") + "\n"
+	} else {
+		output += t.Translate(c.Children.Filter("firstname")) + " " + t.Translate(c.Children.Filter("surname")) + " (" + t.Translate(c.Children.Filter("email")) + ")"
+	}
+	return output
+}
+
+func (t *Translator) term(c *xmlTree.Chunk) string {
+	var output string
+	term := strings.TrimSpace(t.Translate(c.Children))
+	plain := strings.TrimSpace(t.Translate(c.Children.FilterOut("indexterm").Flatten().Filter("TEXT")))
+	if id, ok := c.Parent.Attributes["id"]; ok {
+		output += "[[" + id + "," + plain + "]]\n"
+	}
+	output += strings.Replace(term, "\n", "", -1)
+	return output
+}
+
+func (t *Translator) rolePhrase(c *xmlTree.Chunk) string {
+	return t.quote(c, "[."+t.Style.role(c)+"]#", "#")
+}
+
+func (t *Translator) trimmed(c *xmlTree.Chunk) string {
+	return strings.TrimSpace(t.Translate(c.Children))
+}
+
+func (t *Translator) monospace(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, t.Style["monospace"]...) {
+		output += t.Translate(c.Children)
+	} else {
+		output += t.quoteWith(c, "`")
+	}
+	return output
+}
+
+func (t *Translator) superscript(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, t.Style["superscript"]...) {
+		output += t.Translate(c.Children)
+	} else {
+		output += t.quoteWith(c, "^")
+	}
+	return output
+}
+
+func (t *Translator) italic(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, t.Style["italics"]...) {
+		output += t.Translate(c.Children)
+	} else {
+		output += t.quoteWith(c, "_")
+	}
+	return output
+}
+
+func (t *Translator) bold(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, t.Style["bold"]...) {
+		output += t.Translate(c.Children)
+	} else {
+		output += t.quoteWith(c, "*")
+	}
+	return output
+}
+
+func (t *Translator) highlight(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, t.Style["highlight"]...) {
+		output += t.Translate(c.Children)
+	} else {
+		output += t.quoteWith(c, "#")
+	}
+	return output
+}
+
+func (t *Translator) indexterm(c *xmlTree.Chunk) string {
+	var output string
+	var terms []string
+	s := strings.TrimSpace(t.Translate(c.Children.Filter("primary").Flatten().Filter("TEXT")))
+	if s != "" {
+		terms = append(terms, s)
+	}
+
+	s = strings.TrimSpace(t.Translate(c.Children.Filter("secondary").Flatten().Filter("TEXT")))
+	if s != "" {
+		terms = append(terms, s)
+	}
+
+	s = strings.TrimSpace(t.Translate(c.Children.Filter("tertiary").Flatten().Filter("TEXT")))
+	if s != "" {
+		terms = append(terms, s)
+	}
+
+	s = strings.TrimSpace(t.Translate(c.Children.Filter("see").Flatten().Filter("TEXT")))
+	if s != "" {
+		terms = append(terms, s)
+	}
+
+	s = strings.TrimSpace(t.Translate(c.Children.Filter("seealso").Flatten().Filter("TEXT")))
+	if s != "" {
+		terms = append(terms, s)
+	}
+
+	if len(terms) > 0 {
+		output += "indexterm:[" + strings.Join(terms, ",") + "]"
+	}
+	return output
+}
+
+func (t *Translator) quotation(c *xmlTree.Chunk) string {
+	return "\"" + t.Translate(c.Children) + "\""
+}
+
+func (t *Translator) manvolnum(c *xmlTree.Chunk) string {
+	return "(" + t.Translate(c.Children) + ")"
+}
+
+func (t *Translator) guibutton(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, t.Style["literal"]...) {
+		output += t.Translate(c.Children)
+	} else {
+		output += "btn:[" + t.Translate(c.Children) + "]"
+	}
+	return output
+}
+
+func (t *Translator) menuchoice(c *xmlTree.Chunk) string {
+	var output string
+	var chs []string
+	for _, ch := range c.Children.FilterOut("guimenu") {
+		chs = append(chs, t.Translate(xmlTree.Chunks{ch}))
+	}
+	output += "menu:" + strings.TrimSpace(t.Translate(c.Children.Filter("guimenu"))) + "[" + strings.Join(chs, " > ") + "]"
+	return output
+}
+
+func (t *Translator) keycap(c *xmlTree.Chunk) string {
+	var output string
+	if t.within(c, "keycombo") {
+		output += t.Translate(c.Children)
+	} else {
+		output += "kbd:[" + t.Translate(c.Children) + "]"
+	}
+	return output
+}
+
+func (t *Translator) keycombo(c *xmlTree.Chunk) string {
+	var output string
+	var chs []string
+	for _, ch := range c.Children {
+		chs = append(chs, t.Translate(xmlTree.Chunks{ch}))
+	}
+	output += "kbd:[" + strings.Join(chs, " + ") + "]"
+	return output
+}
+
+func (t *Translator) contents(c *xmlTree.Chunk) string {
+	return t.Translate(c.Children)
+}
+
+func (t *Translator) remark(c *xmlTree.Chunk) string {
+	return "\n//" + t.Translate(c.Children) + "\n"
+}
+
+func (t *Translator) keyword(c *xmlTree.Chunk) string {
+	var output string
+	if t.Doc.Keywords == nil {
+		t.Doc.Keywords = make(map[string]struct{})
+	}
+	t.Doc.Keywords[strings.TrimSpace(t.Translate(c.Children))] = struct{}{}
+	return output
+}
+
+func (t *Translator) unknown(c *xmlTree.Chunk) string {
+	var output strings.Builder
+	var warned bool
+	for _, ch := range c.Children {
+		s := t.Translate(xmlTree.Chunks{ch})
+		if ch.IsKind("TEXT") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				t.warn(color.YellowString("Unknown:"), ch.XML())
+				warned = true
+			}
+		}
+		output.WriteString(s)
+	}
+	if warned {
+		t.Doc.Unknown["<"+c.Kind+">"]++
+	}
+	return output.String()
+}
@@ -0,0 +1,200 @@
+package translate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/clayts/docscii/asciiDoc"
+	"github.com/clayts/docscii/xmlTree"
+)
+
+// Jobs is how many chapters are translated at once.
+var Jobs = 1
+
+// The chapters a book includes are usually independent of one another, so
+// when Jobs allows, each is translated on its own while the rest of the book
+// carries on. Anything a translation does that others could see, such as
+// naming the files it creates or printing a message, is recorded as an event
+// instead, and the events are played back in document order once everything
+// has been translated. Until then, the text of each chapter and the name of
+// each file is stood in for by a placeholder, so the result is the same as if
+// the book had been translated in turn.
+
+// event is one of a message, a file to create or a translation to wait for.
+type event struct {
+	message []interface{}
+	create  *creation
+	future  *future
+}
+
+type creation struct {
+	title, data string
+	placeholder string
+}
+
+type future struct {
+	placeholder string
+	t           *Translator
+	output      string
+	done        chan struct{}
+	// panicked holds what the translation panicked with, to be raised again
+	// by whoever waits for it.
+	panicked interface{}
+}
+
+var placeholders int64
+
+// newPlaceholder returns a string which cannot appear in translated text.
+func newPlaceholder() string {
+	return "\x00" + strconv.FormatInt(atomic.AddInt64(&placeholders, 1), 10) + "\x00"
+}
+
+// substitute replaces the placeholders in s with their values.
+func substitute(s string, values map[string]string) string {
+	if !strings.Contains(s, "\x00") {
+		return s
+	}
+	var output strings.Builder
+	for {
+		i := strings.IndexByte(s, 0)
+		if i < 0 {
+			break
+		}
+		end := strings.IndexByte(s[i+1:], 0)
+		if end < 0 {
+			break
+		}
+		output.WriteString(s[:i])
+		output.WriteString(values[s[i:i+end+2]])
+		s = s[i+end+2:]
+	}
+	output.WriteString(s)
+	return output.String()
+}
+
+// create adds a file to the document and returns its name, or a placeholder
+// for the name while events are being recorded.
+func (t *Translator) create(title, data string) string {
+	if !t.deferred {
+		return t.Doc.Create(title, data)
+	}
+	p := newPlaceholder()
+	t.events = append(t.events, event{create: &creation{title: title, data: data, placeholder: p}})
+	return p
+}
+
+// warn prints a message, or records it while events are being recorded.
+func (t *Translator) warn(a ...interface{}) {
+	if t.quiet {
+		return
+	}
+	if !t.deferred {
+		fmt.Println(a...)
+		return
+	}
+	t.events = append(t.events, event{message: a})
+}
+
+// structural lists the elements which only join up the translations of their
+// children, so that an include within them can be translated on its own.
+var structural = []string{"book", "article", "part", "chapter", "appendix", "preface", "section"}
+
+// independent reports whether c is an include which can be translated
+// concurrently with the rest of the document: one within nothing but
+// structural elements, whose contents neither declare entities, hold
+// document information nor need a registered handler.
+func (t *Translator) independent(c *xmlTree.Chunk) bool {
+	if !c.IsKind("include") || c.Attributes["parse"] == "text" || t.isOmittedInclude(c) {
+		return false
+	}
+	if _, ok := handlers["include"]; ok {
+		return false
+	}
+	for _, a := range c.Ancestors() {
+		if _, ok := handlers[a.Kind]; ok || !a.IsKind(structural...) || t.isTemplated(a) || t.isAdmonition(a) {
+			return false
+		}
+	}
+	for _, ch := range c.Children.Flatten() {
+		if _, ok := handlers[ch.Kind]; ok || ch.IsKind("ENTITY", "set", "book", "article", "bookinfo", "articleinfo", "setinfo") {
+			return false
+		}
+	}
+	return true
+}
+
+// spawn starts translating c on its own, returning a placeholder for the
+// result.
+func (t *Translator) spawn(c *xmlTree.Chunk) string {
+	doc := asciiDoc.New()
+	doc.Docinfo = t.Doc.Docinfo
+	for k, v := range t.Doc.Entities {
+		doc.Entities[k] = v
+	}
+	child := &Translator{Doc: doc, Source: t.Source, Style: t.Style, Data: t.Data, deferred: true}
+	child.register = make(map[*xmlTree.Chunk]struct{})
+	child.ancestors = make(map[*xmlTree.Chunk]map[string]bool)
+	child.safe = make(map[*xmlTree.Chunk]bool)
+	child.quotes, child.unquoted = t.quotes, t.unquoted
+	for _, text := range (xmlTree.Chunks{c}).Flatten().Filter("TEXT") {
+		if _, ok := t.register[text]; ok {
+			child.register[text] = struct{}{}
+			delete(t.register, text)
+		}
+	}
+	f := &future{placeholder: newPlaceholder(), t: child, done: make(chan struct{})}
+	t.events = append(t.events, event{future: f})
+	t.slots <- struct{}{}
+	go func() {
+		defer func() {
+			f.panicked = recover()
+			<-t.slots
+			close(f.done)
+		}()
+		f.output = child.Translate(xmlTree.Chunks{c})
+	}()
+	return f.placeholder
+}
+
+// resolve waits for the translations started by t, plays back the events in
+// order, and returns s with its placeholders replaced. Afterwards t works in
+// turn, as usual.
+func (t *Translator) resolve(s string) string {
+	values := make(map[string]string)
+	t.replay(t.events, values)
+	t.events, t.deferred, t.slots = nil, false, nil
+	return substitute(s, values)
+}
+
+func (t *Translator) replay(events []event, values map[string]string) {
+	for _, e := range events {
+		switch {
+		case e.message != nil:
+			fmt.Println(e.message...)
+		case e.create != nil:
+			values[e.create.placeholder] = t.Doc.Create(e.create.title, substitute(e.create.data, values))
+		case e.future != nil:
+			f := e.future
+			<-f.done
+			if f.panicked != nil {
+				panic(f.panicked)
+			}
+			t.replay(f.t.events, values)
+			values[f.placeholder] = substitute(f.output, values)
+			for k, v := range f.t.Doc.Resources {
+				t.Doc.Resources[k] = v
+			}
+			for k := range f.t.Doc.Keywords {
+				t.Doc.Keywords[k] = struct{}{}
+			}
+			for k, n := range f.t.Doc.Unknown {
+				t.Doc.Unknown[k] += n
+			}
+			for text := range f.t.register {
+				t.register[text] = struct{}{}
+			}
+		}
+	}
+}
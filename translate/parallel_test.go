@@ -0,0 +1,46 @@
+package translate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/clayts/docscii/asciiDoc"
+	"github.com/clayts/docscii/docBook"
+)
+
+// TestJobs checks that translating the chapters of a book concurrently gives
+// the same result as translating them in turn. Run it with -race.
+func TestJobs(t *testing.T) {
+	defer func(jobs int) { Jobs = jobs }(Jobs)
+	db := docBook.NewFromFile(generateBook(t, t.TempDir(), 12))
+	if db == nil || len(db.Errors) > 0 {
+		t.Fatal("could not load the generated book")
+	}
+	translate := func(jobs int) *asciiDoc.Doc {
+		Jobs = jobs
+		return AsciiDocFromDocBook(db)
+	}
+	want := translate(1)
+	if len(want.Data) < 13 {
+		t.Fatalf("the book was translated into %d files, want a file per chapter", len(want.Data))
+	}
+	for i := 0; i < 3; i++ {
+		got := translate(8)
+		for name, data := range want.Data {
+			if got.Data[name] != data {
+				t.Errorf("-j 8 translated %s differently:\n%s\nwant\n%s", name, got.Data[name], data)
+			}
+		}
+		if len(got.Data) != len(want.Data) || !reflect.DeepEqual(got.Resources, want.Resources) || !reflect.DeepEqual(got.Unknown, want.Unknown) {
+			t.Errorf("-j 8 wrote files %v, want %v", keys(got.Data), keys(want.Data))
+		}
+	}
+}
+
+func keys(m map[string]string) []string {
+	var output []string
+	for k := range m {
+		output = append(output, k)
+	}
+	return output
+}
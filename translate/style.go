@@ -0,0 +1,216 @@
+package translate
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/clayts/docscii/xmlTree"
+)
+
+func init() {
+	DefaultStyle = NewStyle()
+	DefaultStyle.AddFromString("admonitions", "note,tip,important,caution,warning")
+	DefaultStyle.AddFromString("inlineadmonitions", "")
+	for _, a := range DefaultStyle["admonitions"] {
+		DefaultStyle.Add("admonitiontypes", "sidebar[role="+a+"]="+a, "formalpara[role="+a+"]="+a)
+	}
+	DefaultStyle.AddFromString("listitems", "listitem,step,biblioentry,member,contrib")
+	DefaultStyle.AddFromString("paragraphs", "para,simpara,subtitle")
+	DefaultStyle.AddFromString("literal", "screen,synopsis,programlisting,indexterm,mediaobject,ENTITY")
+
+	DefaultStyle.AddFromString("custom", "package,application,citetitle,command,option")
+	DefaultStyle.AddFromString("monospace", "literal,wordasword,filename,guilabel,systemitem,prompt,computeroutput,userinput,revnumber,parameter,guimenuitem,errortype,varname,function,methodname,classname,property,type,command,option,sgmltag,code,envar,guiicon")
+	DefaultStyle.AddFromString("superscript", "superscript")
+	DefaultStyle.AddFromString("italics", "firstterm,replaceable,citebiblioid,citetitle,citation,mathphrase,lineannotation")
+	DefaultStyle.AddFromString("bold", "emphasis,orgname,trademark,acronym,abbrev,uri,refentrytitle,application,package,productname")
+	DefaultStyle.AddFromString("highlight", "")
+	DefaultStyle.AddFromString("legalnotice", "file")
+	DefaultStyle.AddFromString("docinfo", "xml")
+	DefaultStyle.AddFromString("revhistory", "table")
+	DefaultStyle.AddFromString("commoncontent", "convert")
+	DefaultStyle.AddFromString("comments", "keep")
+	DefaultStyle.Add("procinsts",
+		"asciidoc={text}",
+		"asciidoc-br= +\\n",
+		"linebreak= +\\n",
+		"asciidoc-pagebreak=\\n\\n<<<\\n",
+		"hard-pagebreak=\\n\\n<<<\\n",
+		"dbtimestamp={localdate}")
+	DefaultStyle.AddFromString("roles", "")
+	DefaultStyle.AddFromString("ignoredroles", "")
+}
+
+var DefaultStyle Style
+
+type Style map[string][]string
+
+func NewStyle() Style { return make(map[string][]string) }
+
+func (s Style) Add(category string, kinds ...string) {
+	s[category] = append(s[category], kinds...)
+}
+
+func (s Style) AddFromString(category string, kindList string) {
+	s.Add(category, strings.Split(kindList, ",")...)
+}
+
+func (s Style) OverrideWith(s2 Style) {
+	for k, v := range s2 {
+		s[k] = v
+	}
+}
+
+// role returns the element's role attribute in AsciiDoc shorthand form
+// (role1.role2), less any values excluded by the "roles" and "ignoredroles"
+// categories. An empty "roles" category preserves every role.
+func (s Style) role(c *xmlTree.Chunk) string {
+	var allowed []string
+	for _, r := range s["roles"] {
+		if r != "" {
+			allowed = append(allowed, r)
+		}
+	}
+	var roles []string
+roleLoop:
+	for _, r := range strings.Fields(c.Attributes["role"]) {
+		for _, ignored := range s["ignoredroles"] {
+			if r == ignored {
+				continue roleLoop
+			}
+		}
+		if len(allowed) == 0 {
+			roles = append(roles, r)
+			continue
+		}
+		for _, a := range allowed {
+			if r == a {
+				roles = append(roles, r)
+				break
+			}
+		}
+	}
+	return strings.Join(roles, ".")
+}
+
+func (s Style) allQuotes() []string {
+	var answer []string
+	answer = append(answer, s["monospace"]...)
+	answer = append(answer, s["superscript"]...)
+	answer = append(answer, s["italics"]...)
+	answer = append(answer, s["bold"]...)
+	answer = append(answer, s["highlight"]...)
+	return answer
+}
+
+func (s Style) unQuotedCustom() []string {
+	var answer []string
+	for _, cc := range s["custom"] {
+		var alreadyQuoted bool
+		for _, q := range s.allQuotes() {
+			if cc == q {
+				alreadyQuoted = true
+				break
+			}
+		}
+		if !alreadyQuoted {
+			answer = append(answer, cc)
+		}
+	}
+	return answer
+}
+
+// lookup returns the value of the most specific entry in category matching c.
+// Entries take the form selector=value, where selector is described at
+// xmlTree.Selector, such as kind, kind[attribute=value] or
+// parent>kind[attribute=value], with * matching any kind.
+func (s Style) lookup(category string, c *xmlTree.Chunk) (string, bool) {
+	var value string
+	best := -1
+	for _, entry := range s[category] {
+		eSplit := strings.SplitN(entry, "=", 2)
+		if len(eSplit) != 2 {
+			continue
+		}
+		selector, v := strings.TrimSpace(eSplit[0]), eSplit[1]
+		if strings.Contains(selector, "[") && !strings.HasSuffix(selector, "]") {
+			// the split landed inside an attribute predicate
+			eSplit = strings.SplitN(entry, "]=", 2)
+			if len(eSplit) != 2 {
+				continue
+			}
+			selector, v = strings.TrimSpace(eSplit[0])+"]", eSplit[1]
+		}
+		score, ok := selectorMatches(selector, c)
+		if !ok || score < best {
+			continue
+		}
+		best = score
+		value = v
+	}
+	return value, best > -1
+}
+
+// template returns the opening and closing markup of the "templates" entry
+// matching c, where {text} marks the element's contents.
+func (s Style) template(c *xmlTree.Chunk) (string, string, bool) {
+	tmpl, ok := s.lookup("templates", c)
+	if !ok {
+		return "", "", false
+	}
+	if tmplSplit := strings.SplitN(tmpl, "{text}", 2); len(tmplSplit) == 2 {
+		return tmplSplit[0], tmplSplit[1], true
+	}
+	return tmpl, "", true
+}
+
+// admonition returns the admonition type c should be rendered as, either
+// because it is one of the "admonitions" or because it matches an
+// "admonitiontypes" entry.
+func (s Style) admonition(c *xmlTree.Chunk) string {
+	if c.IsKind(s["admonitions"]...) {
+		return c.Kind
+	}
+	a, _ := s.lookup("admonitiontypes", c)
+	return strings.ToLower(strings.TrimSpace(a))
+}
+
+// styleSelectors holds the selectors of style entries, each parsed once; one
+// that could not be parsed is held as nil.
+var styleSelectors sync.Map
+
+// selectorMatches reports whether c matches selector, and how specific the
+// match is.
+func selectorMatches(selector string, c *xmlTree.Chunk) (int, bool) {
+	v, ok := styleSelectors.Load(selector)
+	if !ok {
+		sel, _ := xmlTree.NewSelector(selector)
+		v, _ = styleSelectors.LoadOrStore(selector, sel)
+	}
+	sel := v.(*xmlTree.Selector)
+	if sel == nil {
+		return 0, false
+	}
+	score := sel.Specificity(c)
+	return score, score > -1
+}
+
+// procinst returns the AsciiDoc a processing instruction with the given
+// target is replaced by, from the "procinsts" entries of the form
+// target=snippet. Later entries take precedence, {text} stands for the
+// instruction and \n for a new line.
+func (s Style) procinst(target string) (string, bool) {
+	var snippet string
+	var found bool
+	for _, entry := range s["procinsts"] {
+		if eSplit := strings.SplitN(entry, "=", 2); len(eSplit) == 2 && strings.TrimSpace(eSplit[0]) == target {
+			snippet = strings.Replace(eSplit[1], "\\n", "\n", -1)
+			found = true
+		}
+	}
+	return snippet, found
+}
+
+func (s Style) hasTemplate(c *xmlTree.Chunk) bool {
+	_, _, ok := s.template(c)
+	return ok
+}
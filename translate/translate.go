@@ -0,0 +1,780 @@
+// Package translate converts DocBook documents into AsciiDoc. Main is a thin
+// command line around it; other programs may import it and replace the
+// handling of any kind of element with RegisterHandler.
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/clayts/docscii/asciiDoc"
+	"github.com/clayts/docscii/docBook"
+	"github.com/clayts/docscii/po"
+	"github.com/clayts/docscii/xmlTree"
+
+	"github.com/fatih/color"
+)
+
+func decorateIfNotBlank(s, pre, suf string) string {
+	if s != "" {
+		return pre + s + suf
+	}
+	return ""
+}
+
+func spaceTrimmings(input string) (string, string) {
+	tlc := strings.TrimLeft(input, " ")
+	var ls string
+	for x := 0; x < len(input)-len(tlc); x++ {
+		ls += " "
+	}
+	trc := strings.TrimRight(input, " ")
+	var rs string
+	for x := 0; x < len(input)-len(trc); x++ {
+		rs += " "
+	}
+	return ls, rs
+}
+
+// quoteSafe reports whether quotes can be substituted in the literal blocks
+// cs without mangling their text. The answer for each block is remembered,
+// because it is asked for every in-line element within it.
+func (t *Translator) quoteSafe(cs xmlTree.Chunks) bool {
+	for _, c := range cs {
+		safe, ok := t.safe[c]
+		if !ok {
+			safe = !c.Children.Flatten().Contains("include") && !strings.ContainsAny(c.Children.Text(), "*^#`_+")
+			t.safe[c] = safe
+		}
+		if !safe {
+			return false
+		}
+	}
+	return true
+}
+
+// within reports whether c is inside an element of one of the given kinds. It
+// is IsWithin, but the kinds of each chunk's ancestors are only collected
+// once, as inline elements ask about a dozen style categories each.
+func (t *Translator) within(c *xmlTree.Chunk, kinds ...string) bool {
+	ancestors := t.ancestorKinds(c)
+	for _, k := range kinds {
+		if ancestors[k] {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Translator) ancestorKinds(c *xmlTree.Chunk) map[string]bool {
+	if c.Parent == nil {
+		return nil
+	}
+	if kinds, ok := t.ancestors[c]; ok {
+		return kinds
+	}
+	kinds := t.ancestorKinds(c.Parent)
+	if !kinds[c.Parent.Kind] {
+		// siblings and descendants share the set until a new kind turns up
+		extended := make(map[string]bool, len(kinds)+1)
+		for k := range kinds {
+			extended[k] = true
+		}
+		extended[c.Parent.Kind] = true
+		kinds = extended
+	}
+	t.ancestors[c] = kinds
+	return kinds
+}
+
+// replaceReferences replaces each &name; in s for which f gives a replacement,
+// in a single pass.
+func replaceReferences(s string, f func(name string) (string, bool)) string {
+	var output strings.Builder
+	var last int
+	for i := 0; i < len(s); i++ {
+		if s[i] != '&' {
+			continue
+		}
+		end := strings.IndexAny(s[i+1:], "&; \t\r\n<")
+		if end < 1 || s[i+1+end] != ';' {
+			continue
+		}
+		if r, ok := f(s[i+1 : i+1+end]); ok {
+			output.WriteString(s[last:i])
+			output.WriteString(r)
+			i += end + 1
+			last = i + 1
+		}
+	}
+	if last == 0 {
+		return s
+	}
+	output.WriteString(s[last:])
+	return output.String()
+}
+
+// hasReference reports whether s refers to any of entities.
+func hasReference(s string, entities map[string]string) bool {
+	var found bool
+	replaceReferences(s, func(name string) (string, bool) {
+		_, ok := entities[name]
+		found = found || ok
+		return "", false
+	})
+	return found
+}
+
+// matchingConditions returns a copy of cs without the chunks excluded by the
+// document's conditions.
+func matchingConditions(cs xmlTree.Chunks, conditions string) xmlTree.Chunks {
+	var output xmlTree.Chunks
+	for _, c := range cs {
+		if docBook.ConditionsMatch(conditions, c.Attributes["condition"]) {
+			n := &xmlTree.Chunk{Kind: c.Kind, Attributes: c.Attributes, Parent: c.Parent}
+			n.AddChildren(matchingConditions(c.Children, conditions))
+			output = append(output, n)
+		}
+	}
+	return output
+}
+
+var brokenInclusions = xmlTree.MustSelector("include > title, include > indexterm")
+
+func bypassBrokenInclusions(cs xmlTree.Chunks) {
+	for _, c := range brokenInclusions.Select(cs) {
+		c.MoveTo(c.Parent.Parent, -1)
+	}
+}
+
+var itemizedMarks = map[string]string{
+	"bullet":     "disc",
+	"disc":       "disc",
+	"circle":     "circle",
+	"opencircle": "circle",
+	"square":     "square",
+	"box":        "square",
+	"none":       "none",
+}
+
+// isListItem reports whether an AsciiDoc line starts an ordered or unordered
+// list item, which would be wrongly attached to the previous item by a list
+// continuation.
+func isListItem(l string) bool {
+	marker := strings.TrimLeft(l, "*")
+	if marker == l {
+		marker = strings.TrimLeft(l, ".")
+	}
+	return marker != l && strings.HasPrefix(marker, " ")
+}
+
+func listAttributes(root xmlTree.Chunks, c *xmlTree.Chunk) string {
+	var attrs []string
+	switch c.Kind {
+	case "orderedlist":
+		if n := c.Attributes["numeration"]; n != "" && n != "arabic" {
+			attrs = append(attrs, n)
+		}
+		if start := listStart(root, c); start != 1 {
+			attrs = append(attrs, "start="+strconv.Itoa(start))
+		}
+	case "itemizedlist":
+		mark := c.Attributes["mark"]
+		// AsciiDoc has no per-item marks, so an override only applies if it is unanimous
+		var override string
+		for i, li := range c.Children.Filter("listitem") {
+			if i == 0 {
+				override = li.Attributes["override"]
+			} else if li.Attributes["override"] != override {
+				override = ""
+				break
+			}
+		}
+		if override != "" {
+			mark = override
+		}
+		if m, ok := itemizedMarks[mark]; ok {
+			attrs = append(attrs, m)
+		}
+	case "table":
+		hints := formattingHints(append(c.Children, c.Children.Filter("tgroup").Children()...))
+		var options string
+		if c.Attributes["pgwide"] == "1" || hints["pgwide"] == "1" {
+			options += "%pgwide"
+		}
+		if c.Attributes["orient"] == "land" || hints["orientation"] == "landscape" {
+			options += "%rotate"
+		}
+		if options != "" {
+			attrs = append(attrs, options)
+		}
+		// AsciiDoc table widths are percentages of the page
+		if w := strings.TrimSpace(hints["table-width"]); strings.HasSuffix(w, "%") {
+			attrs = append(attrs, "width="+w)
+		}
+	}
+	return strings.Join(attrs, ",")
+}
+
+var pseudoAttribute = regexp.MustCompile(`([A-Za-z][\w.-]*)\s*=\s*("[^"]*"|'[^']*')`)
+
+// formattingHints returns the pseudo-attributes of the <?dbhtml?> and <?dbfo?>
+// processing instructions among cs, with which DocBook XSL users tune output.
+func formattingHints(cs xmlTree.Chunks) map[string]string {
+	hints := make(map[string]string)
+	for _, c := range cs.Filter("PROCINST") {
+		if c.Attributes["TARGET"] == "dbhtml" || c.Attributes["TARGET"] == "dbfo" {
+			for _, m := range pseudoAttribute.FindAllStringSubmatch(c.Attributes["INSTRUCTION"], -1) {
+				hints[m[1]] = m[2][1 : len(m[2])-1]
+			}
+		}
+	}
+	return hints
+}
+
+func listStart(root xmlTree.Chunks, c *xmlTree.Chunk) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(c.Attributes["startingnumber"])); err == nil {
+		return n
+	}
+	if c.Attributes["continuation"] == "continues" {
+		if prev := precedingList(root, c); prev != nil {
+			return listStart(root, prev) + len(prev.Children.Filter("listitem"))
+		}
+	}
+	return 1
+}
+
+// precedingList returns the last list of c's kind before c in the document,
+// other than the lists c is within. Only c's preceding siblings and those of
+// its ancestors are searched.
+func precedingList(root xmlTree.Chunks, c *xmlTree.Chunk) *xmlTree.Chunk {
+	for n := c; n != nil; n = n.Parent {
+		siblings := root
+		if n.Parent != nil {
+			siblings = n.Parent.Children
+		}
+		i := len(siblings) - 1
+		for i > -1 && siblings[i] != n {
+			i--
+		}
+		for i--; i > -1; i-- {
+			if l := lastOfKind(siblings[i], c.Kind); l != nil {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// lastOfKind returns the last chunk of the given kind in document order
+// among c and its descendants.
+func lastOfKind(c *xmlTree.Chunk, kind string) *xmlTree.Chunk {
+	for i := len(c.Children) - 1; i > -1; i-- {
+		if l := lastOfKind(c.Children[i], kind); l != nil {
+			return l
+		}
+	}
+	if c.IsKind(kind) {
+		return c
+	}
+	return nil
+}
+
+// publicanEntities maps publican.cfg fields to the attributes they provide
+// for use in the document.
+var publicanEntities = map[string]string{
+	"product": "ProductName",
+	"version": "ProductVersion",
+	"edition": "Edition",
+	"docname": "DocName",
+}
+
+// publicanAttributes derives document attributes from a publican.cfg.
+func publicanAttributes(ad *asciiDoc.Doc, publicanCfg map[string]string) {
+	switch strings.ToLower(publicanCfg["type"]) {
+	case "article":
+		ad.Attributes["doctype"] = "article"
+	case "book", "set":
+		ad.Attributes["doctype"] = "book"
+	}
+	if depth := publicanCfg["chunk_section_depth"]; depth != "" {
+		ad.Attributes["multipage-level"] = depth
+	}
+	if depth := publicanCfg["toc_section_depth"]; depth != "" {
+		ad.Attributes["toclevels"] = depth
+	}
+	for k, e := range publicanEntities {
+		if v := publicanCfg[k]; v != "" {
+			if _, ok := ad.Entities[e]; !ok {
+				ad.Entities[e] = v
+			}
+		}
+	}
+}
+
+func AsciiDocFromDocBook(db *docBook.Doc, Styles ...Style) *asciiDoc.Doc {
+	cfg := NewStyle()
+	cfg.OverrideWith(DefaultStyle)
+	for _, s := range Styles {
+		cfg.OverrideWith(s)
+	}
+	ad := asciiDoc.New()
+	ad.Docinfo = cfg["docinfo"]
+	publicanAttributes(ad, db.PublicanCfg)
+	translateInto(ad, db, cfg)
+	return ad
+}
+
+// bookDir returns the output directory for a book or article within a set.
+func bookDir(c *xmlTree.Chunk, n int) string {
+	name := c.Attributes["id"]
+	if name == "" {
+		title := c.Children.Filter("title")
+		title = append(title, c.Children.Filter("bookinfo", "articleinfo", "info").Children().Filter("title")...)
+		name = strings.TrimSpace(title.Text())
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		name = c.Kind + "-" + strconv.Itoa(n)
+	}
+	return name
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// tidy removes redundant mark up from translated AsciiDoc and replaces
+// entities with attribute references.
+func tidy(d string, entities map[string]string) string {
+	d = strings.Replace(d, "``", "` `", -1)
+	for _, delim := range " ,.!?-\n()|" {
+		d = strings.Replace(d, "pass:attributes[{blank}]"+string(delim), string(delim), -1)
+		d = strings.Replace(d, string(delim)+"pass:attributes[{blank}]", string(delim), -1)
+	}
+	d = strings.Replace(d, "pass:attributes[{blank}]:", ":", -1)
+	d = replaceReferences(d, func(name string) (string, bool) {
+		_, ok := entities[name]
+		return "{" + name + "}", ok
+	})
+	return strings.TrimSpace(blankLines.ReplaceAllString(d, "\n\n"))
+}
+
+// Translator holds the state of a translation, for the handlers that render
+// each element.
+type Translator struct {
+	// Doc is the AsciiDoc being written.
+	Doc *asciiDoc.Doc
+	// Source is the DocBook being translated.
+	Source *docBook.Doc
+	Style  Style
+	// Data is the DocBook tree, as prepared for translation.
+	Data xmlTree.Chunks
+	// register holds the text not yet translated.
+	register map[*xmlTree.Chunk]struct{}
+	// revisionHistory is appended to the master file.
+	revisionHistory string
+	// ancestors and safe remember what within and quoteSafe have found.
+	ancestors map[*xmlTree.Chunk]map[string]bool
+	safe      map[*xmlTree.Chunk]bool
+	// quotes and unquoted are the style's quoting kinds, and the custom kinds
+	// without quotes of their own.
+	quotes, unquoted []string
+	// slots limits how many includes are translated at once when they are
+	// translated concurrently, and deferred records events instead of acting
+	// on them; see parallel.go.
+	slots    chan struct{}
+	deferred bool
+	events   []event
+	// quiet drops warnings, for translations made a second time.
+	quiet bool
+}
+
+// translateInto translates db into ad, which may already hold entities.
+func translateInto(ad *asciiDoc.Doc, db *docBook.Doc, cfg Style) {
+	data := db.Data.Copy()
+	for _, c := range data {
+		// books from a set are translated as documents in their own right
+		c.Parent = nil
+	}
+	if root := data.Flatten().First("set", "book", "article"); root != nil && root.IsKind("article") {
+		ad.Attributes["doctype"] = "article"
+	} else if root != nil {
+		ad.Attributes["doctype"] = "book"
+	}
+	t := &Translator{Doc: ad, Source: db, Style: cfg, Data: data}
+	t.register = make(map[*xmlTree.Chunk]struct{})
+	t.ancestors = make(map[*xmlTree.Chunk]map[string]bool)
+	t.safe = make(map[*xmlTree.Chunk]bool)
+	t.quotes, t.unquoted = cfg.allQuotes(), cfg.unQuotedCustom()
+	for _, text := range data.Flatten().Filter("TEXT") {
+		t.register[text] = struct{}{}
+	}
+	if Jobs > 1 {
+		t.slots = make(chan struct{}, Jobs)
+		t.deferred = true
+	}
+	bypassBrokenInclusions(data)
+	ad.Data["master.adoc"] = t.resolve(t.Translate(data) + t.revisionHistory)
+	t.segments()
+
+	for f, d := range ad.Data {
+		ad.Data[f] = tidy(d, ad.Entities)
+	}
+	for c := range t.register {
+		if s := strings.TrimSpace(c.XML()); s != "" {
+			fmt.Println(color.RedString("\nUnprocessed:"), s)
+			fmt.Println(c.Parent.XML())
+		}
+	}
+}
+
+// segments translates each message numbered by po.Number on its own, for the
+// PO files. The messages are translated a second time by a scratch translator
+// on a copy of the document, so that the warnings, files and counts of the
+// translation proper are not made twice.
+func (t *Translator) segments() {
+	var numbered xmlTree.Chunks
+	for _, c := range t.Data.Flatten() {
+		if _, ok := c.Attributes["MESSAGE"]; ok {
+			numbered = append(numbered, c)
+		}
+	}
+	if len(numbered) == 0 {
+		return
+	}
+	doc := asciiDoc.New()
+	for k, v := range t.Doc.Entities {
+		doc.Entities[k] = v
+	}
+	for k, v := range t.Doc.Data {
+		doc.Data[k] = v
+	}
+	scratch := &Translator{Doc: doc, Source: t.Source, Style: t.Style, Data: t.Data, quiet: true}
+	scratch.register = make(map[*xmlTree.Chunk]struct{})
+	scratch.ancestors, scratch.safe = t.ancestors, t.safe
+	scratch.quotes, scratch.unquoted = t.quotes, t.unquoted
+	condition := t.Source.PublicanCfg["condition"]
+	for _, c := range numbered {
+		visible := docBook.ConditionsMatch(condition, c.Attributes["condition"])
+		for _, a := range c.Ancestors() {
+			visible = visible && docBook.ConditionsMatch(condition, a.Attributes["condition"])
+		}
+		if !visible {
+			continue
+		}
+		// the message's own text, without the blocks translated separately
+		var content xmlTree.Chunks
+		for _, ch := range c.Children {
+			if !po.IsPlaceholder(ch) {
+				content = append(content, ch)
+			}
+		}
+		segment := scratch.Translate(content)
+		if !c.IsKind("screen", "programlisting", "literallayout", "synopsis", "address") {
+			segment = strings.Join(strings.Fields(segment), " ")
+		}
+		t.Doc.Segments[c.Attributes["MESSAGE"]] = tidy(segment, t.Doc.Entities)
+	}
+}
+
+// Translate renders cs as AsciiDoc, leaving out the chunks excluded by the
+// document's conditions.
+func (t *Translator) Translate(cs xmlTree.Chunks) string {
+	var output strings.Builder
+	for _, c := range cs {
+		if c == nil {
+			continue
+		}
+		if docBook.ConditionsMatch(t.Source.PublicanCfg["condition"], c.Attributes["condition"]) {
+			if t.slots != nil && t.independent(c) {
+				output.WriteString(t.spawn(c))
+			} else if h, ok := handlers[c.Kind]; ok {
+				output.WriteString(h(t, c))
+			} else {
+				output.WriteString(t.Builtin(c))
+			}
+		} else {
+			delete(t.register, c)
+			for _, ch := range c.Children.Flatten() {
+				delete(t.register, ch)
+			}
+		}
+	}
+	return output.String()
+}
+
+// Builtin renders c as docscii does when no handler is registered for it.
+func (t *Translator) Builtin(c *xmlTree.Chunk) string {
+	for _, b := range builtinHandlers {
+		if b.match(t, c) {
+			return b.handle(t, c)
+		}
+	}
+	return t.unknown(c)
+}
+
+func (t *Translator) decorateTitle(c *xmlTree.Chunk, prefix string) string {
+	output := "\n\n"
+	if id, ok := c.Attributes["id"]; ok {
+		output += "[[" + id + "]]\n"
+	}
+	if role := t.Style.role(c); role != t.Style.admonition(c) {
+		// a role that selected an admonition type has served its purpose
+		output += decorateIfNotBlank(role, "[.", "]\n")
+	}
+	title := c.Children.Filter("title")
+	output += decorateIfNotBlank(t.Translate(title), prefix, "")
+	return output
+}
+
+func (t *Translator) quote(c *xmlTree.Chunk, open, close string) string {
+	var output string
+	contents := t.Translate(c.Children)
+	ls, rs := spaceTrimmings(contents)
+	con := strings.TrimSpace(contents)
+	if con != "" {
+		literal := t.within(c, t.Style["literal"]...)
+		block := t.within(c, "screen", "synopsis", "programlisting")
+		safe := block && t.quoteSafe(c.Ancestors().Filter("screen", "synopsis", "programlisting"))
+		esc := block && (!c.IsKind(t.Style["custom"]...) && !t.within(c, t.quotes...) && !t.within(c, t.unquoted...) && !strings.Contains(con, "]"))
+		if !literal || safe {
+			output += ls + "pass:attributes[{blank}]" + open + con + close + "pass:attributes[{blank}]" + rs
+		} else if esc {
+			pass := "quotes"
+			if hasReference(con, t.Doc.Entities) {
+				pass += ",attributes"
+			}
+			output += ls + "pass:" + pass + "[" + open + con + close + "]" + rs
+		} else {
+			output += ls + con + rs
+		}
+	}
+	return output
+}
+
+func (t *Translator) quoteWith(c *xmlTree.Chunk, quoter string) string {
+	var tag string
+	if c.IsKind(t.Style["custom"]...) {
+		tag = c.Kind
+	}
+	tag += decorateIfNotBlank(t.Style.role(c), ".", "")
+	return t.quote(c, decorateIfNotBlank(tag, "[", "]")+quoter, quoter)
+}
+
+func (t *Translator) paragraph(c *xmlTree.Chunk) string {
+	var children strings.Builder
+	for i, child := range c.Children {
+		if !child.IsKind(t.Style["literal"]...) && !child.IsKind("literallayout", "address", "revhistory") {
+			text := t.Translate(xmlTree.Chunks{child})
+			for strings.Contains(text, "  ") {
+				text = strings.Replace(text, "  ", " ", -1)
+			}
+			text = strings.Replace(text, "\t", "", -1)
+			text = strings.Replace(text, "\n ", "\n", -1)
+			if child.IsKind("COMMENT") && text != "" {
+				// the comment lines split the paragraph's text
+				trimmed := strings.TrimRight(children.String(), " ")
+				children.Reset()
+				children.WriteString(trimmed)
+			} else if i > 0 && c.Children[i-1].IsKind("COMMENT", "PROCINST") && strings.HasSuffix(children.String(), "\n") {
+				// a blank line would end the paragraph
+				text = strings.TrimLeft(text, " \n")
+			}
+			children.WriteString(text)
+		} else {
+			children.WriteString(t.Translate(xmlTree.Chunks{child}))
+		}
+	}
+	return strings.TrimSpace(children.String())
+}
+
+func (t *Translator) plain(cs xmlTree.Chunks) string {
+	return strings.Join(strings.Fields(t.Translate(cs.Flatten().Filter("TEXT"))), " ")
+}
+
+func (t *Translator) personName(c *xmlTree.Chunk) string {
+	if c.IsKind("corpauthor") {
+		return t.plain(xmlTree.Chunks{c})
+	}
+	var names []string
+	for _, n := range append(c.Children, c.Children.Filter("personname").Children()...).Filter("honorific", "firstname", "othername", "surname", "lineage") {
+		names = append(names, t.plain(xmlTree.Chunks{n}))
+	}
+	return strings.Join(names, " ")
+}
+
+// infoChildren returns the children of an info element with the contents of
+// the files it includes in place of the includes, as Publican books keep their
+// authors in Author_Group.xml and their legal notice in Common_Content.
+func (t *Translator) infoChildren(c *xmlTree.Chunk) xmlTree.Chunks {
+	var output xmlTree.Chunks
+	for _, ch := range c.Children {
+		if ch.IsKind("include") && ch.Attributes["parse"] != "text" && !t.isOmittedInclude(ch) && docBook.ConditionsMatch(t.Source.PublicanCfg["condition"], ch.Attributes["condition"]) {
+			output = append(output, t.infoChildren(ch).FilterOut("fallback")...)
+		} else {
+			output = append(output, ch)
+		}
+	}
+	return output
+}
+
+// header returns AsciiDoc document header attributes describing the
+// authors, copyright and latest revision recorded in an info element.
+func (t *Translator) header(c *xmlTree.Chunk) string {
+	var attrs []string
+	children := t.infoChildren(c)
+	authors := children.Filter("author", "editor", "corpauthor")
+	authors = append(authors, children.Filter("authorgroup").Children().Filter("author", "editor", "corpauthor")...)
+	for i, a := range authors {
+		name := t.personName(a)
+		var suffix string
+		if i > 0 {
+			suffix = "_" + strconv.Itoa(i+1)
+		}
+		attrs = append(attrs, decorateIfNotBlank(name, ":author"+suffix+": ", ""))
+		attrs = append(attrs, decorateIfNotBlank(t.plain(a.Children.Filter("email")), ":email"+suffix+": ", ""))
+		for _, ch := range a.Children.Flatten() {
+			delete(t.register, ch)
+		}
+	}
+	if len(authors) > 1 {
+		attrs = append(attrs, ":authorcount: "+strconv.Itoa(len(authors)))
+	}
+	// Publican lists the most recent revision first
+	if rev := t.Data.Flatten().First("revision"); rev != nil {
+		attrs = append(attrs, decorateIfNotBlank(t.plain(rev.Children.Filter("revnumber")), ":revnumber: ", ""))
+		attrs = append(attrs, decorateIfNotBlank(t.plain(rev.Children.Filter("date")), ":revdate: ", ""))
+		attrs = append(attrs, decorateIfNotBlank(t.plain(rev.Children.Filter("revremark")), ":revremark: ", ""))
+	}
+	attrs = append(attrs, decorateIfNotBlank(t.plain(children.Filter("abstract")), ":description: ", ""))
+	for _, cr := range children.Filter("copyright") {
+		var years []string
+		for _, y := range cr.Children.Filter("year") {
+			years = append(years, t.plain(xmlTree.Chunks{y}))
+		}
+		var holders []string
+		for _, h := range cr.Children.Filter("holder") {
+			holders = append(holders, t.plain(xmlTree.Chunks{h}))
+		}
+		attrs = append(attrs, decorateIfNotBlank(strings.TrimSpace(strings.Join(years, ", ")+" "+strings.Join(holders, ", ")), ":copyright: ", ""))
+	}
+	var output string
+	for _, a := range attrs {
+		output += decorateIfNotBlank(a, "\n", "")
+	}
+	return output
+}
+
+// revhistoryTable reports whether revision histories are rendered as tables.
+func (t *Translator) revhistoryTable() bool {
+	return len(t.Style["revhistory"]) == 0 || t.Style["revhistory"][0] != "list"
+}
+
+// nestedTable reports whether c is part of a table within a table cell, whose
+// cells AsciiDoc separates with ! rather than |.
+func (t *Translator) nestedTable(c *xmlTree.Chunk) bool {
+	return t.within(c, "entry") || t.within(c, "revhistory") && t.revhistoryTable()
+}
+
+// revisionDescription renders the changes a revision lists. Publican lists
+// them in a simplelist, which reads as separate lines rather than bullets.
+func (t *Translator) revisionDescription(c *xmlTree.Chunk) string {
+	var parts []string
+	for _, ch := range c.Children.FilterOut("TEXT") {
+		if !ch.IsKind("simplelist") {
+			parts = append(parts, strings.TrimSpace(t.Translate(xmlTree.Chunks{ch})))
+			continue
+		}
+		for _, m := range ch.Children.Filter("member") {
+			if docBook.ConditionsMatch(t.Source.PublicanCfg["condition"], m.Attributes["condition"]) {
+				parts = append(parts, strings.TrimSpace(t.Translate(m.Children)))
+			}
+		}
+	}
+	var output []string
+	for _, p := range parts {
+		if p != "" {
+			output = append(output, p)
+		}
+	}
+	return strings.Join(output, "\n\n")
+}
+
+func (t *Translator) renderRevhistory(c *xmlTree.Chunk) string {
+	output := t.decorateTitle(c, ".")
+	table := t.revhistoryTable()
+	if table {
+		output += "\n[cols=\"2,3,3,6\",options=\"header\"]\n|===\n|Revision |Date |Author |Description\n"
+	}
+	for _, rev := range c.Children.Filter("revision") {
+		number := t.plain(rev.Children.Filter("revnumber"))
+		date := t.plain(rev.Children.Filter("date"))
+		var authors []string
+		for _, a := range rev.Children.Filter("author", "authorinitials") {
+			if a.IsKind("authorinitials") {
+				authors = append(authors, t.plain(xmlTree.Chunks{a}))
+			} else {
+				authors = append(authors, t.personName(a))
+			}
+			for _, ch := range a.Children.Flatten() {
+				delete(t.register, ch)
+			}
+		}
+		author := strings.Join(authors, ", ")
+		var description []string
+		if remark := strings.TrimSpace(t.Translate(rev.Children.Filter("revremark").Children())); remark != "" {
+			description = append(description, remark)
+		}
+		for _, rd := range rev.Children.Filter("revdescription") {
+			if desc := t.revisionDescription(rd); desc != "" {
+				description = append(description, desc)
+			}
+		}
+		if table {
+			output += "\n|" + strings.Replace(number, "|", "\\|", -1) + "\n|" + strings.Replace(date, "|", "\\|", -1) + "\n|" + strings.Replace(author, "|", "\\|", -1)
+			output += "\na|" + strings.Replace(strings.Join(description, "\n\n"), "|", "\\|", -1) + "\n"
+		} else {
+			output += "\n" + number + ":: " + date + decorateIfNotBlank(author, ", ", "") + "\n"
+			output += decorateIfNotBlank(strings.Join(description, "\n\n"), "+\n--\n", "\n--\n")
+		}
+	}
+	if table {
+		output += "|===\n"
+	}
+	return output
+}
+
+// comment renders an XML comment as line comments within a paragraph, where
+// a delimited block would end it, and otherwise as a comment block. Comments
+// cannot be expressed inside literal blocks, titles and in-line mark up, so
+// they are dropped there.
+func (t *Translator) comment(c *xmlTree.Chunk) string {
+	text := strings.Trim(c.Attributes["COMMENT"], " \t\r\n")
+	if text == "" || len(t.Style["comments"]) > 0 && t.Style["comments"][0] == "drop" {
+		return ""
+	}
+	if t.within(c, t.Style["literal"]...) || t.within(c, "literallayout", "address", "title", "term", "tgroup", "footnote", "textobject", "keyword", "subjectterm", "remark") {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	if c.Parent != nil && c.Parent.IsKind(t.Style["paragraphs"]...) {
+		var output string
+		for _, l := range lines {
+			output += "\n//" + decorateIfNotBlank(strings.TrimSpace(l), " ", "")
+		}
+		return output + "\n"
+	}
+	if t.within(c, t.Style["paragraphs"]...) {
+		return ""
+	}
+	if len(lines) == 1 {
+		return "\n\n// " + text + "\n"
+	}
+	return "\n\n////\n" + text + "\n////\n"
+}
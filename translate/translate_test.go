@@ -0,0 +1,132 @@
+package translate
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/clayts/docscii/docBook"
+	"github.com/clayts/docscii/xmlTree"
+)
+
+func TestReplaceReferences(t *testing.T) {
+	values := map[string]string{"a": "A", "b": "B", "empty": ""}
+	f := func(name string) (string, bool) {
+		v, ok := values[name]
+		return v, ok
+	}
+	tests := map[string]string{
+		"":              "",
+		"no references": "no references",
+		"&a;&b;":        "AB",
+		"x &a; y &b; z": "x A y B z",
+		"&a;;":          "A;",
+		"&&a;":          "&A",
+		"<&a;>":         "<A>",
+		"&empty;.":      ".",
+		"&unknown; &a;": "&unknown; A",
+		"&amp;a;":       "&amp;a;",
+		"&a &b;":        "&a B",
+		"&a<b;":         "&a<b;",
+		"&;":            "&;",
+		"trailing &a":   "trailing &a",
+		"&a\n;":         "&a\n;",
+	}
+	for in, want := range tests {
+		if got := replaceReferences(in, f); got != want {
+			t.Errorf("replaceReferences(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHasReference(t *testing.T) {
+	entities := map[string]string{"PRODUCT": "Docscii"}
+	tests := map[string]bool{
+		"Use &PRODUCT; now": true,
+		"&PRODUCT":          false,
+		"&amp; &lt;":        false,
+		"&product;":         false,
+	}
+	for in, want := range tests {
+		if got := hasReference(in, entities); got != want {
+			t.Errorf("hasReference(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestTidy(t *testing.T) {
+	entities := map[string]string{"PRODUCT": "Docscii", "VERSION": "2"}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"adjacent backticks", "``a``", "` `a` `"},
+		{"blank before punctuation", "*bold*pass:attributes[{blank}], then", "*bold*, then"},
+		{"blank after space", "a pass:attributes[{blank}]_b_", "a _b_"},
+		{"blank before colon", "Term pass:attributes[{blank}]:", "Term :"},
+		{"blank kept between words", "a_b_pass:attributes[{blank}]c", "a_b_pass:attributes[{blank}]c"},
+		{"entities", "&PRODUCT; &VERSION; &amp; &other;", "{PRODUCT} {VERSION} &amp; &other;"},
+		{"blank lines", "\n\nOne\n\n\n\nTwo\n\n\nThree\n\n", "One\n\nTwo\n\nThree"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tidy(tt.in, entities); got != tt.want {
+				t.Errorf("tidy(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMemberDirectories(t *testing.T) {
+	db := &docBook.Doc{Data: xmlTree.New(`<set><title>Set</title>` +
+		`<book><title>Guide</title><chapter><title>One</title><para>1</para></chapter></book>` +
+		`<book><title>Guide</title><chapter><title>Two</title><para>2</para></chapter></book>` +
+		`<book id="Guide"><title>Other</title><chapter><title>Three</title><para>3</para></chapter></book>` +
+		`</set>`)}
+	ad := AsciiDocFromDocBook(db)
+	var dirs []string
+	for dir := range ad.Books {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	if want := []string{"Guide", "Guide-2", "Guide-3"}; strings.Join(dirs, " ") != strings.Join(want, " ") {
+		t.Fatalf("set members written to %v, want %v", dirs, want)
+	}
+	for _, dir := range dirs {
+		if n := strings.Count(ad.Data["master.adoc"], "xref:"+dir+"/master.adoc["); n != 1 {
+			t.Errorf("the index links %s %d times", dir, n)
+		}
+	}
+}
+
+func TestNestedTableCell(t *testing.T) {
+	inner := `<informaltable><tgroup cols="1"><tbody><row><entry>in</entry></row></tbody></tgroup></informaltable>`
+	db := &docBook.Doc{Data: xmlTree.New(`<article><title>A</title><informaltable><tgroup cols="2"><tbody>` +
+		`<row><entry>x</entry><entry>` + inner + `</entry></row>` +
+		`<row><entry>` + inner + `</entry><entry>y</entry></row>` +
+		`</tbody></tgroup></informaltable></article>`)}
+	got := AsciiDocFromDocBook(db).Data["master.adoc"]
+	for _, want := range []string{"\n|x\na|\n!===\n", "\n\na|\n!===\n1+!in\n!===\n|y"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBlockquoteAttribution(t *testing.T) {
+	tests := map[string]string{
+		`Someone, <citetitle>A Book</citetitle>`:   "[quote, Someone, A Book]",
+		`Someone; <citetitle>A Book</citetitle>`:   "[quote, Someone, A Book]",
+		"Someone :\n<citetitle>A Book</citetitle>": "[quote, Someone, A Book]",
+		`Someone`:     "[quote, Someone]",
+		`Smith, John`: `[quote, "Smith, John"]`,
+		`Smith, John, <citetitle>A Book</citetitle>`: `[quote, "Smith, John", A Book]`,
+	}
+	for attribution, want := range tests {
+		db := &docBook.Doc{Data: xmlTree.New(`<article><title>A</title><blockquote><attribution>` + attribution + `</attribution><para>Words.</para></blockquote></article>`)}
+		if got := AsciiDocFromDocBook(db).Data["master.adoc"]; !strings.Contains(got, "\n"+want+"\n") {
+			t.Errorf("attribution %q gave\n%s\nwant %s", attribution, got, want)
+		}
+	}
+}
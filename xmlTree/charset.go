@@ -0,0 +1,151 @@
+package xmlTree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// windows1252 holds the characters windows-1252 places where ISO-8859-1 has
+// C1 control codes.
+var windows1252 = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// iso885915 holds the characters ISO-8859-15 changes from ISO-8859-1.
+var iso885915 = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž', 0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+}
+
+func decodeSingleByte(b []byte, table map[byte]rune) string {
+	var output strings.Builder
+	for _, c := range b {
+		if r, ok := table[c]; ok {
+			output.WriteRune(r)
+		} else {
+			output.WriteRune(rune(c))
+		}
+	}
+	return output.String()
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		if bigEndian {
+			u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		} else {
+			u[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+// Decode transcodes b from the named character encoding to UTF-8.
+func Decode(b []byte, charset string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if !utf8.Valid(b) {
+			return "", errors.New("invalid UTF-8")
+		}
+		return string(b), nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1", "l1":
+		return decodeSingleByte(b, nil), nil
+	case "windows-1252", "cp1252":
+		return decodeSingleByte(b, windows1252), nil
+	case "iso-8859-15", "iso8859-15", "latin-9":
+		return decodeSingleByte(b, iso885915), nil
+	case "utf-16":
+		if bytes.HasPrefix(b, []byte{0xFE, 0xFF}) {
+			return decodeUTF16(b[2:], true), nil
+		}
+		return decodeUTF16(bytes.TrimPrefix(b, []byte{0xFF, 0xFE}), false), nil
+	case "utf-16be":
+		return decodeUTF16(b, true), nil
+	case "utf-16le":
+		return decodeUTF16(b, false), nil
+	}
+	return "", errors.New("unsupported character encoding " + charset)
+}
+
+// charsetReader lets the XML decoder read documents that declare encodings
+// other than UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Decode(b, charset)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(s), nil
+}
+
+// ToUTF8 prepares raw file contents for parsing. Documents in other encodings
+// are transcoded and their declarations removed, so that the parser never
+// needs to go back to the declaration, and undeclared documents that are not
+// valid UTF-8 are assumed to be windows-1252, the usual culprit. The bool
+// reports whether that guess was made.
+func ToUTF8(b []byte) (string, bool, error) {
+	if bytes.HasPrefix(b, []byte{0xFE, 0xFF}) || bytes.HasPrefix(b, []byte{0xFF, 0xFE}) {
+		s, _ := Decode(b, "utf-16")
+		return stripDeclaration(s), false, nil
+	}
+	b = bytes.TrimPrefix(b, []byte{0xEF, 0xBB, 0xBF})
+	if enc := declaredEncoding(b); enc != "" {
+		s, err := Decode(b, enc)
+		if err != nil {
+			return "", false, err
+		}
+		if strings.EqualFold(enc, "utf-8") {
+			return s, false, nil
+		}
+		return stripDeclaration(s), false, nil
+	}
+	if utf8.Valid(b) {
+		return string(b), false, nil
+	}
+	s, _ := Decode(b, "windows-1252")
+	return s, true, nil
+}
+
+// declaredEncoding returns the encoding named in an XML declaration.
+func declaredEncoding(b []byte) string {
+	if !bytes.HasPrefix(b, []byte("<?xml")) {
+		return ""
+	}
+	decl := string(b)
+	if end := strings.Index(decl, "?>"); end > -1 {
+		decl = decl[:end]
+	}
+	i := strings.Index(decl, "encoding")
+	if i < 0 {
+		return ""
+	}
+	decl = strings.TrimLeft(decl[i+len("encoding"):], " \t\r\n=")
+	if decl == "" {
+		return ""
+	}
+	quote := decl[0]
+	if end := strings.IndexByte(decl[1:], quote); end > -1 {
+		return decl[1 : end+1]
+	}
+	return ""
+}
+
+func stripDeclaration(s string) string {
+	if strings.HasPrefix(s, "<?xml") {
+		if end := strings.Index(s, "?>"); end > -1 {
+			return s[end+2:]
+		}
+	}
+	return s
+}
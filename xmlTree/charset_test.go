@@ -0,0 +1,82 @@
+package xmlTree
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		charset string
+		in      []byte
+		want    string
+		err     bool
+	}{
+		{"UTF-8", []byte("caf\xc3\xa9"), "café", false},
+		{"utf-8", []byte("caf\xe9"), "", true},
+		{"latin1", []byte("caf\xe9 \x80"), "café \u0080", false},
+		{"windows-1252", []byte("\x93quoted\x94 \x80"), "“quoted” €", false},
+		{"ISO-8859-15", []byte("\xa4\xbd"), "€œ", false},
+		{"utf-16", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "hi", false},
+		{"utf-16", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, "hi", false},
+		{"utf-16be", []byte{0, 'h', 0x20, 0xAC}, "h€", false},
+		{"utf-16le", []byte{'h', 0, 0xAC, 0x20}, "h€", false},
+		{"ebcdic", []byte("x"), "", true},
+	}
+	for _, tt := range tests {
+		got, err := Decode(tt.in, tt.charset)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("Decode(%q, %q) = %q, %v, want %q (error %v)", tt.in, tt.charset, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		want    string
+		guessed bool
+		err     bool
+	}{
+		{"plain", []byte("<a>é</a>"), "<a>é</a>", false, false},
+		{"UTF-8 BOM", []byte("\xef\xbb\xbf<a/>"), "<a/>", false, false},
+		{"UTF-8 declared", []byte("<?xml version='1.0' encoding='UTF-8'?><a/>"), "<?xml version='1.0' encoding='UTF-8'?><a/>", false, false},
+		{"latin1 declared", []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<a>\xe9</a>"), "\n<a>é</a>", false, false},
+		{"declaration spacing", []byte("<?xml version='1.0' encoding = \"windows-1252\" ?><a>\x96</a>"), "<a>–</a>", false, false},
+		{"UTF-16 BOM", []byte{0xFF, 0xFE, '<', 0, 'a', 0, '/', 0, '>', 0}, "<a/>", false, false},
+		{"UTF-16 BOM with declaration", append([]byte{0xFE, 0xFF}, utf16be("<?xml version='1.0' encoding='UTF-16'?><a/>")...), "<a/>", false, false},
+		{"undeclared windows-1252", []byte("<a>\x93x\x94</a>"), "<a>“x”</a>", true, false},
+		{"declared but invalid", []byte("<?xml version='1.0' encoding='utf-8'?><a>\xe9</a>"), "", false, true},
+		{"unsupported", []byte("<?xml version='1.0' encoding='koi8-r'?><a/>"), "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, guessed, err := ToUTF8(tt.in)
+			if (err != nil) != tt.err || got != tt.want || guessed != tt.guessed {
+				t.Errorf("ToUTF8(%q) = %q, %v, %v, want %q, %v (error %v)", tt.in, got, guessed, err, tt.want, tt.guessed, tt.err)
+			}
+		})
+	}
+}
+
+func TestDeclaredEncoding(t *testing.T) {
+	tests := map[string]string{
+		"<?xml version='1.0' encoding='latin1'?>":      "latin1",
+		"<?xml version=\"1.0\" encoding=\"UTF-8\"?>":   "UTF-8",
+		"<?xml version='1.0'?><a encoding='x'/>":       "",
+		"<?xml version='1.0' standalone='yes'?>":       "",
+		"<a/>":                                         "",
+		"<?xml version='1.0' encoding='unterminated?>": "",
+	}
+	for in, want := range tests {
+		if got := declaredEncoding([]byte(in)); got != want {
+			t.Errorf("declaredEncoding(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func utf16be(s string) []byte {
+	var b []byte
+	for _, r := range s {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return b
+}
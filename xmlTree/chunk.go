@@ -5,6 +5,9 @@ type Chunk struct {
 	Attributes map[string]string
 	Parent     *Chunk
 	Children   Chunks
+	// references holds the offsets of the unresolved entity references in
+	// each attribute's value
+	references map[string][]int
 }
 
 func newChunk(kind string) *Chunk {
@@ -20,6 +23,12 @@ func newTextChunk(text string) *Chunk {
 	return c
 }
 
+func newReferenceChunk(name string) *Chunk {
+	c := newTextChunk("&" + name + ";")
+	c.Attributes["REFERENCE"] = name
+	return c
+}
+
 func newDirectiveChunk(text string) *Chunk {
 	c := newChunk("DIRECTIVE")
 	c.Attributes["DIRECTIVE"] = text
@@ -33,21 +42,10 @@ func newProcessingInstructionChunk(target, instruction string) *Chunk {
 	return c
 }
 
-func (c Chunk) XML() string {
-	if c.IsKind("TEXT") {
-		return c.Attributes["TEXT"]
-	}
-	var kvs string
-	for k, v := range c.Attributes {
-		kvs += " " + k + "=\"" + v + "\""
-	}
-	output := "<" + c.Kind + kvs + ">"
-
-	for _, child := range c.Children {
-		output += child.XML()
-	}
-	output += "</" + c.Kind + ">"
-	return output
+func newCommentChunk(text string) *Chunk {
+	c := newChunk("COMMENT")
+	c.Attributes["COMMENT"] = text
+	return c
 }
 
 func (c *Chunk) AddChildren(children Chunks) {
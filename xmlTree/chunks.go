@@ -2,14 +2,6 @@ package xmlTree
 
 type Chunks []*Chunk
 
-func (cs Chunks) XML() string {
-	var output string
-	for _, c := range cs {
-		output += c.XML()
-	}
-	return output
-}
-
 func (cs Chunks) Filter(kinds ...string) Chunks {
 	var output Chunks
 	for _, c := range cs {
@@ -82,6 +74,7 @@ func (cs Chunks) Copy() Chunks {
 		for k, v := range c.Attributes {
 			n.Attributes[k] = v
 		}
+		n.references = c.references
 		n.Parent = c.Parent
 		n.AddChildren(c.Children.Copy())
 
@@ -91,10 +84,13 @@ func (cs Chunks) Copy() Chunks {
 }
 
 func (cs Chunks) Flatten() Chunks {
-	var output Chunks
+	return cs.flattenInto(nil)
+}
+
+func (cs Chunks) flattenInto(output Chunks) Chunks {
 	for _, c := range cs {
 		output = append(output, c)
-		output = append(output, c.Children.Flatten()...)
+		output = c.Children.flattenInto(output)
 	}
 	return output
 }
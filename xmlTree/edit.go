@@ -0,0 +1,144 @@
+package xmlTree
+
+import "errors"
+
+// NewChunk returns an element of the given kind with no attributes.
+func NewChunk(kind string) *Chunk {
+	return newChunk(kind)
+}
+
+// NewTextChunk returns a chunk of text.
+func NewTextChunk(text string) *Chunk {
+	return newTextChunk(text)
+}
+
+// The editing methods below keep Parent and Children consistent, detaching
+// any chunk they place from wherever it was before. They build new Children
+// slices rather than editing them in place, so that a loop ranging over the
+// old slice is not disturbed. Chunks without a parent are held in a Chunks
+// slice of the caller's, which only the caller can change.
+
+// Index returns c's position among its parent's children, or -1.
+func (c *Chunk) Index() int {
+	if c.Parent == nil {
+		return -1
+	}
+	for i, ch := range c.Parent.Children {
+		if ch == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// Remove detaches c from its parent.
+func (c *Chunk) Remove() {
+	i := c.Index()
+	if i > -1 {
+		children := c.Parent.Children
+		var rest Chunks
+		rest = append(rest, children[:i]...)
+		c.Parent.Children = append(rest, children[i+1:]...)
+	}
+	c.Parent = nil
+}
+
+// InsertChildren places cs among c's children, starting at index. An index
+// out of range appends them. It fails, changing nothing, if one of cs is c or
+// holds it, since the chunk would then be within itself.
+func (c *Chunk) InsertChildren(index int, cs ...*Chunk) error {
+	moving := make(map[*Chunk]bool, len(cs))
+	for _, ch := range cs {
+		for a := c; a != nil; a = a.Parent {
+			if a == ch {
+				return errors.New("<" + ch.Kind + "> cannot be placed within itself")
+			}
+		}
+		moving[ch] = true
+	}
+	if index < 0 || index > len(c.Children) {
+		index = len(c.Children)
+	}
+	// each former parent loses its moving children in one go
+	detached := make(map[*Chunk]bool)
+	for _, ch := range cs {
+		if p := ch.Parent; p != nil && !detached[p] {
+			detached[p] = true
+			if p == c {
+				for _, s := range c.Children[:index] {
+					if moving[s] {
+						index--
+					}
+				}
+			}
+			p.Children = without(p.Children, moving)
+		}
+		ch.Parent = c
+	}
+	children := make(Chunks, 0, len(c.Children)+len(cs))
+	children = append(children, c.Children[:index]...)
+	children = append(children, cs...)
+	c.Children = append(children, c.Children[index:]...)
+	return nil
+}
+
+// without returns a copy of cs leaving out the chunks in leave.
+func without(cs Chunks, leave map[*Chunk]bool) Chunks {
+	var output Chunks
+	for _, c := range cs {
+		if !leave[c] {
+			output = append(output, c)
+		}
+	}
+	return output
+}
+
+// InsertBefore places cs immediately before c. It panics if c has no parent.
+func (c *Chunk) InsertBefore(cs ...*Chunk) error {
+	c.mustHaveParent()
+	return c.Parent.InsertChildren(c.Index(), cs...)
+}
+
+// InsertAfter places cs immediately after c. It panics if c has no parent.
+func (c *Chunk) InsertAfter(cs ...*Chunk) error {
+	c.mustHaveParent()
+	return c.Parent.InsertChildren(c.Index()+1, cs...)
+}
+
+// Replace puts cs in c's place, detaching c. It panics if c has no parent.
+func (c *Chunk) Replace(cs ...*Chunk) error {
+	c.mustHaveParent()
+	if err := c.InsertAfter(cs...); err != nil {
+		return err
+	}
+	c.Remove()
+	return nil
+}
+
+// Unwrap replaces c with its children. It panics if c has no parent.
+func (c *Chunk) Unwrap() {
+	c.Replace(append(Chunks{}, c.Children...)...)
+	c.Children = nil
+}
+
+// Wrap puts a new element of the given kind in c's place, with c as its only
+// child, and returns it. It panics if c has no parent.
+func (c *Chunk) Wrap(kind string) *Chunk {
+	c.mustHaveParent()
+	w := newChunk(kind)
+	c.InsertBefore(w)
+	w.InsertChildren(0, c)
+	return w
+}
+
+// MoveTo detaches c and places it among parent's children at index, appending
+// it if index is out of range. It fails if parent is c or within it.
+func (c *Chunk) MoveTo(parent *Chunk, index int) error {
+	return parent.InsertChildren(index, c)
+}
+
+func (c *Chunk) mustHaveParent() {
+	if c.Parent == nil {
+		panic("<" + c.Kind + "> has no parent")
+	}
+}
@@ -0,0 +1,176 @@
+package xmlTree
+
+import "testing"
+
+// checkParents reports children whose Parent is not the chunk holding them.
+func checkParents(t *testing.T, cs Chunks, parent *Chunk) {
+	t.Helper()
+	for _, c := range cs {
+		if c.Parent != parent {
+			t.Errorf("<%s %s> has the wrong parent", c.Kind, c.Attributes["id"])
+		}
+		checkParents(t, c.Children, c)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	const doc = `<a><b id="1"/><b id="2"><i/><j/></b><b id="3"/></a><z/>`
+	// byID returns the chunk with the given id
+	byID := func(cs Chunks, id string) *Chunk {
+		return cs.Select("*[@id='" + id + "']")[0]
+	}
+	tests := []struct {
+		name string
+		edit func(cs Chunks) Chunks
+		want string
+	}{
+		{"Remove", func(cs Chunks) Chunks {
+			byID(cs, "2").Remove()
+			return cs
+		}, `<a><b id="1"/><b id="3"/></a><z/>`},
+		{"Remove without parent", func(cs Chunks) Chunks {
+			cs[1].Remove()
+			return cs
+		}, `<a><b id="1"/><b id="2"><i/><j/></b><b id="3"/></a><z/>`},
+		{"InsertChildren", func(cs Chunks) Chunks {
+			cs[0].InsertChildren(1, NewChunk("x"), NewTextChunk("t"))
+			return cs
+		}, `<a><b id="1"/><x/>t<b id="2"><i/><j/></b><b id="3"/></a><z/>`},
+		{"InsertChildren out of range", func(cs Chunks) Chunks {
+			cs[0].InsertChildren(-1, NewChunk("x"))
+			cs[0].InsertChildren(10, NewChunk("y"))
+			return cs
+		}, `<a><b id="1"/><b id="2"><i/><j/></b><b id="3"/><x/><y/></a><z/>`},
+		{"InsertChildren of own children", func(cs Chunks) Chunks {
+			cs[0].InsertChildren(3, byID(cs, "1"))
+			return cs
+		}, `<a><b id="2"><i/><j/></b><b id="3"/><b id="1"/></a><z/>`},
+		{"InsertChildren moves", func(cs Chunks) Chunks {
+			cs[0].InsertChildren(0, cs.Select("j")[0])
+			return cs
+		}, `<a><j/><b id="1"/><b id="2"><i/></b><b id="3"/></a><z/>`},
+		{"InsertBefore", func(cs Chunks) Chunks {
+			byID(cs, "2").InsertBefore(NewChunk("x"), NewChunk("y"))
+			return cs
+		}, `<a><b id="1"/><x/><y/><b id="2"><i/><j/></b><b id="3"/></a><z/>`},
+		{"InsertBefore itself", func(cs Chunks) Chunks {
+			byID(cs, "3").InsertBefore(byID(cs, "1"))
+			return cs
+		}, `<a><b id="2"><i/><j/></b><b id="1"/><b id="3"/></a><z/>`},
+		{"InsertAfter", func(cs Chunks) Chunks {
+			byID(cs, "3").InsertAfter(NewChunk("x"))
+			return cs
+		}, `<a><b id="1"/><b id="2"><i/><j/></b><b id="3"/><x/></a><z/>`},
+		{"InsertAfter sibling", func(cs Chunks) Chunks {
+			byID(cs, "1").InsertAfter(byID(cs, "3"))
+			return cs
+		}, `<a><b id="1"/><b id="3"/><b id="2"><i/><j/></b></a><z/>`},
+		{"Replace", func(cs Chunks) Chunks {
+			byID(cs, "2").Replace(NewChunk("x"), NewChunk("y"))
+			return cs
+		}, `<a><b id="1"/><x/><y/><b id="3"/></a><z/>`},
+		{"Replace with nothing", func(cs Chunks) Chunks {
+			byID(cs, "1").Replace()
+			return cs
+		}, `<a><b id="2"><i/><j/></b><b id="3"/></a><z/>`},
+		{"Unwrap", func(cs Chunks) Chunks {
+			byID(cs, "2").Unwrap()
+			return cs
+		}, `<a><b id="1"/><i/><j/><b id="3"/></a><z/>`},
+		{"Wrap", func(cs Chunks) Chunks {
+			byID(cs, "2").Wrap("w").Attributes["id"] = "w"
+			return cs
+		}, `<a><b id="1"/><w id="w"><b id="2"><i/><j/></b></w><b id="3"/></a><z/>`},
+		{"MoveTo", func(cs Chunks) Chunks {
+			byID(cs, "1").MoveTo(byID(cs, "2"), 1)
+			return cs
+		}, `<a><b id="2"><i/><b id="1"/><j/></b><b id="3"/></a><z/>`},
+		{"MoveTo from outside", func(cs Chunks) Chunks {
+			cs[1].MoveTo(cs[0], -1)
+			return cs[:1]
+		}, `<a><b id="1"/><b id="2"><i/><j/></b><b id="3"/><z/></a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := tt.edit(New(doc))
+			if got := cs.XML(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			checkParents(t, cs, nil)
+		})
+	}
+}
+
+func TestInsertWithinItself(t *testing.T) {
+	const doc = `<a><b><c/></b></a>`
+	cs := New(doc)
+	b := cs[0].Children[0]
+	c := b.Children[0]
+	for name, err := range map[string]error{
+		"itself":         b.InsertChildren(0, b),
+		"its parent":     c.InsertChildren(0, b),
+		"among others":   c.InsertChildren(0, NewChunk("x"), cs[0]),
+		"InsertBefore":   c.InsertBefore(b),
+		"Replace":        c.Replace(cs[0]),
+		"MoveTo":         b.MoveTo(c, 0),
+		"MoveTo as root": cs[0].MoveTo(c, -1),
+	} {
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if got := cs.XML(); got != doc {
+		t.Errorf("the failed edits changed the document to %s", got)
+	}
+	checkParents(t, cs, nil)
+}
+
+func TestUnwrapMany(t *testing.T) {
+	w := NewChunk("w")
+	for i := 0; i < 10000; i++ {
+		w.AddChild(NewChunk("x"))
+	}
+	a := NewChunk("a")
+	a.AddChildren(Chunks{NewChunk("y"), w, NewChunk("z")})
+	w.Unwrap()
+	if len(a.Children) != 10002 || a.Children[0].Kind != "y" || a.Children[10001].Kind != "z" {
+		t.Fatalf("Unwrap() left %d children", len(a.Children))
+	}
+	checkParents(t, a.Children, a)
+}
+
+func TestIndex(t *testing.T) {
+	cs := New(`<a>x<b/><c/></a>`)
+	for i, c := range cs[0].Children {
+		if got := c.Index(); got != i {
+			t.Errorf("Index() of child %d = %d", i, got)
+		}
+	}
+	if got := cs[0].Index(); got != -1 {
+		t.Errorf("Index() without parent = %d, want -1", got)
+	}
+	c := cs[0].Children[1]
+	c.Remove()
+	if got := c.Index(); got != -1 {
+		t.Errorf("Index() once removed = %d, want -1", got)
+	}
+}
+
+func TestEditWithoutParentPanics(t *testing.T) {
+	for name, edit := range map[string]func(c *Chunk){
+		"InsertBefore": func(c *Chunk) { c.InsertBefore(NewChunk("x")) },
+		"InsertAfter":  func(c *Chunk) { c.InsertAfter(NewChunk("x")) },
+		"Replace":      func(c *Chunk) { c.Replace(NewChunk("x")) },
+		"Unwrap":       func(c *Chunk) { c.Unwrap() },
+		"Wrap":         func(c *Chunk) { c.Wrap("x") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s without a parent did not panic", name)
+				}
+			}()
+			edit(NewChunk("a"))
+		}()
+	}
+}
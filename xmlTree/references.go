@@ -0,0 +1,146 @@
+package xmlTree
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The decoder leaves the entities it cannot resolve in the text as they were
+// written, where they cannot be told from text that escaped its ampersand. So
+// the references are found again in the markup: in text each becomes a TEXT
+// chunk of its own, with its name in a REFERENCE attribute, and in attribute
+// values their offsets are kept in the chunk's references.
+
+var reference = regexp.MustCompile(`&(#[0-9]+|#x[0-9A-Fa-f]+|[A-Za-z_:][\w.:-]*);`)
+
+var predefined = map[string]string{"amp": "&", "lt": "<", "gt": ">", "apos": "'", "quot": "\""}
+
+var newlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// unescape decodes markup that holds no unresolved reference.
+func unescape(raw string) string {
+	return reference.ReplaceAllStringFunc(newlines.Replace(raw), func(ref string) string {
+		name := ref[1 : len(ref)-1]
+		if s, ok := predefined[name]; ok {
+			return s
+		}
+		var n int64
+		var err error
+		if strings.HasPrefix(name, "#x") {
+			n, err = strconv.ParseInt(name[2:], 16, 32)
+		} else if strings.HasPrefix(name, "#") {
+			n, err = strconv.ParseInt(name[1:], 10, 32)
+		} else {
+			return ref
+		}
+		if err != nil {
+			return ref
+		}
+		return string(rune(n))
+	})
+}
+
+// decode decodes raw, returning the offsets of the references it leaves
+// unresolved.
+func decode(raw string) (string, []int) {
+	var output strings.Builder
+	var offsets []int
+	last := 0
+	for _, m := range reference.FindAllStringSubmatchIndex(raw, -1) {
+		name := raw[m[2]:m[3]]
+		if _, ok := predefined[name]; ok || strings.HasPrefix(name, "#") {
+			continue
+		}
+		output.WriteString(unescape(raw[last:m[0]]))
+		offsets = append(offsets, output.Len())
+		output.WriteString(raw[m[0]:m[1]])
+		last = m[1]
+	}
+	output.WriteString(unescape(raw[last:]))
+	return output.String(), offsets
+}
+
+// referenceAt returns the reference at the start of s, or "".
+func referenceAt(s string) string {
+	if m := reference.FindStringSubmatchIndex(s); m != nil && m[0] == 0 && !strings.HasPrefix(s, "&#") {
+		if _, ok := predefined[s[m[2]:m[3]]]; !ok {
+			return s[:m[1]]
+		}
+	}
+	return ""
+}
+
+// textChunks returns the chunks for text, which was written as raw.
+func textChunks(raw, text string) Chunks {
+	if !strings.Contains(text, "&") || strings.HasPrefix(raw, "<![CDATA[") {
+		return Chunks{newTextChunk(text)}
+	}
+	decoded, offsets := decode(raw)
+	if decoded != text || len(offsets) == 0 {
+		return Chunks{newTextChunk(text)}
+	}
+	var output Chunks
+	last := 0
+	for _, o := range offsets {
+		if o > last {
+			output = append(output, newTextChunk(text[last:o]))
+		}
+		ref := referenceAt(text[o:])
+		output = append(output, newReferenceChunk(ref[1:len(ref)-1]))
+		last = o + len(ref)
+	}
+	if last < len(text) {
+		output = append(output, newTextChunk(text[last:]))
+	}
+	return output
+}
+
+var attribute = regexp.MustCompile(`([^\s=<>/"']+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// attributeReferences returns the offsets of the unresolved references in the
+// values of attributes, read from tag, the start tag they were written in.
+func attributeReferences(tag string, attributes map[string]string) map[string][]int {
+	var output map[string][]int
+	for _, m := range attribute.FindAllStringSubmatch(tag, -1) {
+		raw := m[2] + m[3]
+		if !strings.Contains(raw, "&") {
+			continue
+		}
+		name := m[1]
+		if i := strings.Index(name, ":"); i > -1 {
+			name = name[i+1:]
+		}
+		if decoded, offsets := decode(raw); len(offsets) > 0 && decoded == attributes[name] {
+			if output == nil {
+				output = make(map[string][]int)
+			}
+			output[name] = offsets
+		}
+	}
+	return output
+}
+
+// EscapeAttribute returns the value of the attribute k escaped by escape,
+// except for the entity references the parser could not resolve, which are
+// left as they were written.
+func (c *Chunk) EscapeAttribute(k string, escape func(string) string) string {
+	s := c.Attributes[k]
+	var output strings.Builder
+	last := 0
+	for _, o := range c.references[k] {
+		if o < last || o >= len(s) {
+			continue
+		}
+		// the value may have been changed since it was parsed
+		ref := referenceAt(s[o:])
+		if ref == "" {
+			continue
+		}
+		output.WriteString(escape(s[last:o]))
+		output.WriteString(ref)
+		last = o + len(ref)
+	}
+	output.WriteString(escape(s[last:]))
+	return output.String()
+}
@@ -0,0 +1,328 @@
+package xmlTree
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A Selector picks out chunks using a subset of CSS and XPath syntax:
+//
+//	chapter para          para elements anywhere within a chapter
+//	listitem > para       para elements that are children of a listitem
+//	para[@role='x']       para elements whose role is x (or para[role=x])
+//	note[@id]             note elements with an id
+//	step[1], step[last()] the first and last step among their siblings
+//	title, subtitle       either
+//
+// * matches any element. Predicates may be chained, each applying to the
+// elements left by the one before, as in XPath.
+type Selector struct {
+	alternatives [][]step
+}
+
+type step struct {
+	// child is set when the step must be a child of the previous step
+	// rather than any descendant.
+	child      bool
+	kind       string
+	predicates []predicate
+	// positional is set when a predicate picks by position, so that the
+	// siblings must be counted
+	positional bool
+}
+
+type predicate struct {
+	attribute string
+	value     string
+	hasValue  bool
+	position  int // 1-based, or -1 for last()
+}
+
+// NewSelector parses s.
+func NewSelector(s string) (*Selector, error) {
+	sel := &Selector{}
+	for _, alt := range splitOutside(s, ',') {
+		steps, err := parseSteps(alt)
+		if err != nil {
+			return nil, errors.New("selector " + strconv.Quote(s) + ": " + err.Error())
+		}
+		sel.alternatives = append(sel.alternatives, steps)
+	}
+	return sel, nil
+}
+
+// MustSelector is like NewSelector but panics if s cannot be parsed.
+func MustSelector(s string) *Selector {
+	sel, err := NewSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// splitOutside splits s on sep where it is not inside brackets or quotes.
+func splitOutside(s string, sep rune) []string {
+	var output []string
+	var depth int
+	var quote rune
+	var start int
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == sep && depth == 0:
+			output = append(output, s[start:i])
+			start = i + len(string(r))
+		}
+	}
+	return append(output, s[start:])
+}
+
+func parseSteps(s string) ([]step, error) {
+	var steps []step
+	child := false
+	// make the child combinator a token of its own
+	s = strings.Join(splitOutside(s, '>'), " > ")
+	for _, token := range splitOutside(s, ' ') {
+		if token = strings.TrimSpace(token); token == "" {
+			continue
+		}
+		if token == ">" {
+			if child || len(steps) == 0 {
+				return nil, errors.New("misplaced >")
+			}
+			child = true
+			continue
+		}
+		st := step{child: child}
+		child = false
+		i := strings.Index(token, "[")
+		if i < 0 {
+			i = len(token)
+		}
+		st.kind = token[:i]
+		if st.kind == "" {
+			return nil, errors.New("missing element name in " + strconv.Quote(token))
+		}
+		for rest := token[i:]; rest != ""; {
+			if rest[0] != '[' {
+				return nil, errors.New("unexpected " + strconv.Quote(rest))
+			}
+			end := closingBracket(rest)
+			if end < 0 {
+				return nil, errors.New("unclosed [ in " + strconv.Quote(token))
+			}
+			p, err := parsePredicate(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, err
+			}
+			st.predicates = append(st.predicates, p)
+			st.positional = st.positional || p.position != 0
+			rest = rest[end+1:]
+		}
+		steps = append(steps, st)
+	}
+	if len(steps) == 0 || child {
+		return nil, errors.New("incomplete selector")
+	}
+	return steps, nil
+}
+
+func closingBracket(s string) int {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parsePredicate(s string) (predicate, error) {
+	if s == "last()" {
+		return predicate{position: -1}, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 {
+			return predicate{}, errors.New("positions start at 1")
+		}
+		return predicate{position: n}, nil
+	}
+	var p predicate
+	pSplit := strings.SplitN(s, "=", 2)
+	p.attribute = strings.TrimPrefix(strings.TrimSpace(pSplit[0]), "@")
+	if p.attribute == "" {
+		return p, errors.New("empty predicate")
+	}
+	if len(pSplit) == 2 {
+		p.hasValue = true
+		p.value = strings.TrimSpace(pSplit[1])
+		if len(p.value) > 1 && (p.value[0] == '\'' || p.value[0] == '"') && p.value[len(p.value)-1] == p.value[0] {
+			p.value = p.value[1 : len(p.value)-1]
+		}
+	}
+	return p, nil
+}
+
+// matches reports whether c satisfies st, with siblings being the chunks
+// among which c's position is counted.
+func (st step) matches(c *Chunk, siblings Chunks) bool {
+	if !st.named(c) {
+		return false
+	}
+	if !st.positional {
+		for _, p := range st.predicates {
+			if !p.matches(c) {
+				return false
+			}
+		}
+		return true
+	}
+	// as in XPath, each predicate narrows down the siblings left by the
+	// name test and the predicates before it
+	var candidates Chunks
+	for _, s := range siblings {
+		if st.named(s) {
+			candidates = append(candidates, s)
+		}
+	}
+	for _, p := range st.predicates {
+		var left Chunks
+		switch {
+		case p.position == -1:
+			left = candidates[len(candidates)-1:]
+		case p.position > 0:
+			if p.position <= len(candidates) {
+				left = candidates[p.position-1 : p.position]
+			}
+		default:
+			for _, s := range candidates {
+				if p.matches(s) {
+					left = append(left, s)
+				}
+			}
+		}
+		candidates = left
+		if len(candidates) == 0 {
+			return false
+		}
+	}
+	for _, s := range candidates {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (st step) named(c *Chunk) bool {
+	return !c.IsKind("TEXT", "COMMENT", "PROCINST", "DIRECTIVE", "ENTITY") && (st.kind == "*" || c.Kind == st.kind)
+}
+
+func (p predicate) matches(c *Chunk) bool {
+	v, ok := c.Attributes[p.attribute]
+	return ok && (!p.hasValue || v == p.value)
+}
+
+// Matches reports whether c is picked out by the selector. The position of a
+// chunk without a parent cannot be known, so it only matches positions of 1.
+func (sel *Selector) Matches(c *Chunk) bool {
+	for _, steps := range sel.alternatives {
+		if matchSteps(steps, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Specificity returns how specific the most specific alternative matching c
+// is, or -1 if none does. As in CSS, a more specific selector names more: each
+// element named counts 1 and each predicate 2.
+func (sel *Selector) Specificity(c *Chunk) int {
+	best := -1
+	for _, steps := range sel.alternatives {
+		if !matchSteps(steps, c) {
+			continue
+		}
+		var score int
+		for _, st := range steps {
+			if st.kind != "*" {
+				score++
+			}
+			score += 2 * len(st.predicates)
+		}
+		if score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+func siblingsOf(c *Chunk) Chunks {
+	if c.Parent == nil {
+		return Chunks{c}
+	}
+	return c.Parent.Children
+}
+
+func matchSteps(steps []step, c *Chunk) bool {
+	last := steps[len(steps)-1]
+	if !last.matches(c, siblingsOf(c)) {
+		return false
+	}
+	if len(steps) == 1 {
+		return true
+	}
+	rest := steps[:len(steps)-1]
+	if last.child {
+		return c.Parent != nil && matchSteps(rest, c.Parent)
+	}
+	for a := c.Parent; a != nil; a = a.Parent {
+		if matchSteps(rest, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the chunks in cs, or within them, that match, in document
+// order.
+func (sel *Selector) Select(cs Chunks) Chunks {
+	var output Chunks
+	for _, c := range cs.Flatten() {
+		if sel.Matches(c) {
+			output = append(output, c)
+		}
+	}
+	return output
+}
+
+// Select returns the chunks in cs, or within them, matching selector, which is
+// described at Selector. It panics if selector cannot be parsed. Selector is
+// parsed on every call, so code selecting repeatedly should keep the result
+// of NewSelector or MustSelector instead.
+func (cs Chunks) Select(selector string) Chunks {
+	return MustSelector(selector).Select(cs)
+}
+
+// Matches reports whether c matches selector, as described at Selector. Like
+// Chunks.Select, it parses selector on every call.
+func (c *Chunk) Matches(selector string) bool {
+	return MustSelector(selector).Matches(c)
+}
@@ -0,0 +1,130 @@
+package xmlTree
+
+import (
+	"strings"
+	"testing"
+)
+
+const selectDoc = `<chapter id="c">
+<title id="t1">One</title>
+<section id="s1" role="x">
+	<title id="t2">Two</title>
+	<para id="p1">A</para>
+	<note id="n1"><para id="p2">B</para></note>
+	<para id="p3" role="x">C</para>
+</section>
+<procedure id="pr">
+	<step id="st1"><para id="p4">D</para></step>
+	<step id="st2" role="y"/>
+	<step id="st3" role="y"/>
+</procedure>
+</chapter>`
+
+// ids returns the ids of cs, separated by spaces.
+func ids(cs Chunks) string {
+	var output []string
+	for _, c := range cs {
+		output = append(output, c.Attributes["id"])
+	}
+	return strings.Join(output, " ")
+}
+
+func TestSelect(t *testing.T) {
+	doc := New(selectDoc)
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"para", "p1 p2 p3 p4"},
+		{"section para", "p1 p2 p3"},
+		{"section > para", "p1 p3"},
+		{"section>para", "p1 p3"},
+		{"chapter > para", ""},
+		{"chapter > * > title", "t2"},
+		{"title, step > para", "t1 t2 p4"},
+		{"para[@role='x']", "p3"},
+		{`para[role="x"]`, "p3"},
+		{"para[role=x]", "p3"},
+		{"*[@role]", "s1 p3 st2 st3"},
+		{"step[1]", "st1"},
+		{"step[last()]", "st3"},
+		{"section > *[2]", "p1"},
+		{"section para[1]", "p1 p2"},
+		{"step[@role='y'][1]", "st2"},
+		{"step[1][@role='y']", ""},
+		{"step[4]", ""},
+		{"procedure step para", "p4"},
+		{"note para, section > para[last()]", "p2 p3"},
+	}
+	for _, tt := range tests {
+		sel, err := NewSelector(tt.selector)
+		if err != nil {
+			t.Errorf("NewSelector(%q) error %v", tt.selector, err)
+			continue
+		}
+		if got := ids(sel.Select(doc)); got != tt.want {
+			t.Errorf("Select(%q) = %q, want %q", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesWithoutParent(t *testing.T) {
+	c := NewChunk("para")
+	for selector, want := range map[string]bool{
+		"para":         true,
+		"para[1]":      true,
+		"para[last()]": true,
+		"para[2]":      false,
+		"note > para":  false,
+		"note para":    false,
+		"*":            true,
+	} {
+		if got := c.Matches(selector); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", selector, got, want)
+		}
+	}
+}
+
+func TestNewSelectorErrors(t *testing.T) {
+	tests := map[string]string{
+		"":           "incomplete selector",
+		"para >":     "incomplete selector",
+		"> para":     "misplaced >",
+		"a > > b":    "misplaced >",
+		"[@id]":      "missing element name",
+		"para[@id":   "unclosed [",
+		"para[@id]x": "unexpected",
+		"para[0]":    "positions start at 1",
+		"para[]":     "empty predicate",
+		"para[=x]":   "empty predicate",
+		"a,":         "incomplete selector",
+	}
+	for selector, want := range tests {
+		_, err := NewSelector(selector)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("NewSelector(%q) error = %v, want %q", selector, err, want)
+		}
+	}
+}
+
+func TestSpecificity(t *testing.T) {
+	c := New(`<sect><para role="x" id="i">t</para></sect>`)[0].Children[0]
+	tests := map[string]int{
+		"*":                         0,
+		"para":                      1,
+		"*[@role=x]":                2,
+		"para[@role=x]":             3,
+		"sect > para[@role=x]":      4,
+		"sect para[@role=x][@id]":   6,
+		"para[@role=y]":             -1,
+		"note, para, *[@role='x']":  2,
+		"note > para":               -1,
+		"para[1][@role=x]":          5,
+		"para[last()], sect > para": 3,
+	}
+	for selector, want := range tests {
+		if got := MustSelector(selector).Specificity(c); got != want {
+			t.Errorf("Specificity(%q) = %d, want %d", selector, got, want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package xmlTree
+
+import (
+	"sort"
+	"strings"
+)
+
+// XMLOptions controls how chunks are serialised.
+type XMLOptions struct {
+	// Indent pretty prints the output when set. Elements containing text are
+	// written on one line with their white space collapsed, so that mixed
+	// content keeps its meaning; the children of other elements are written
+	// on lines of their own, indented by Indent for each level.
+	Indent string
+	// Namespaces maps prefixes to URIs. Each is declared on the outermost
+	// elements whose names, or whose attributes' names, use it.
+	Namespaces map[string]string
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+var attributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+// XML serialises c. Attributes are written in name order, and the upper case
+// attributes docscii uses for its own bookkeeping are left out.
+func (c Chunk) XML() string {
+	return c.XMLWith(XMLOptions{})
+}
+
+func (c Chunk) XMLWith(o XMLOptions) string {
+	return o.serialise(&c, 0, nil)
+}
+
+func (cs Chunks) XML() string {
+	return cs.XMLWith(XMLOptions{})
+}
+
+func (cs Chunks) XMLWith(o XMLOptions) string {
+	if o.Indent == "" {
+		var output strings.Builder
+		for _, c := range cs {
+			output.WriteString(o.serialise(c, 0, nil))
+		}
+		return output.String()
+	}
+	var lines []string
+	for _, c := range cs {
+		if c.IsKind("TEXT") && strings.TrimSpace(c.Attributes["TEXT"]) == "" {
+			continue
+		}
+		lines = append(lines, o.serialise(c, 0, nil))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Text returns the text within cs, without any mark up.
+func (cs Chunks) Text() string {
+	var output strings.Builder
+	for _, c := range cs.Flatten().Filter("TEXT") {
+		output.WriteString(c.Attributes["TEXT"])
+	}
+	return output.String()
+}
+
+func prefix(name string) string {
+	if i := strings.Index(name, ":"); i > -1 {
+		return name[:i]
+	}
+	return ""
+}
+
+func (o XMLOptions) serialise(c *Chunk, depth int, declared map[string]bool) string {
+	switch c.Kind {
+	case "TEXT":
+		if c.Attributes["REFERENCE"] != "" {
+			return "&" + c.Attributes["REFERENCE"] + ";"
+		}
+		return textEscaper.Replace(c.Attributes["TEXT"])
+	case "COMMENT":
+		return "<!--" + c.Attributes["COMMENT"] + "-->"
+	case "PROCINST":
+		if c.Attributes["INSTRUCTION"] == "" {
+			return "<?" + c.Attributes["TARGET"] + "?>"
+		}
+		return "<?" + c.Attributes["TARGET"] + " " + c.Attributes["INSTRUCTION"] + "?>"
+	case "DIRECTIVE", "ENTITY":
+		// an entity file's contents are children of the directive that
+		// declared it, but they were never part of this document
+		return "<!" + c.Attributes["DIRECTIVE"] + ">"
+	}
+	var keys []string
+	for k := range c.Attributes {
+		if k != strings.ToUpper(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	output := "<" + c.Kind
+	var prefixes []string
+	for _, name := range append([]string{c.Kind}, keys...) {
+		if p := prefix(name); p != "" && !declared[p] && o.Namespaces[p] != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if len(prefixes) > 0 {
+		sort.Strings(prefixes)
+		inherited := declared
+		declared = make(map[string]bool)
+		for p := range inherited {
+			declared[p] = true
+		}
+		for _, p := range prefixes {
+			if !declared[p] {
+				declared[p] = true
+				output += " xmlns:" + p + "=\"" + attributeEscaper.Replace(o.Namespaces[p]) + "\""
+			}
+		}
+	}
+	for _, k := range keys {
+		output += " " + k + "=\"" + c.EscapeAttribute(k, attributeEscaper.Replace) + "\""
+	}
+	if len(c.Children) == 0 {
+		return output + "/>"
+	}
+	output += ">"
+	if o.Indent == "" {
+		for _, ch := range c.Children {
+			output += o.serialise(ch, depth+1, declared)
+		}
+		return output + "</" + c.Kind + ">"
+	}
+	if strings.TrimSpace(c.Children.Filter("TEXT").Text()) != "" {
+		inline := XMLOptions{Namespaces: o.Namespaces}
+		var contents string
+		for _, ch := range c.Children {
+			contents += inline.serialise(collapsed(ch), depth+1, declared)
+		}
+		return output + strings.TrimSpace(contents) + "</" + c.Kind + ">"
+	}
+	indent := strings.Repeat(o.Indent, depth+1)
+	for _, ch := range c.Children {
+		if ch.IsKind("TEXT") {
+			continue
+		}
+		output += "\n" + indent + o.serialise(ch, depth+1, declared)
+	}
+	return output + "\n" + strings.Repeat(o.Indent, depth) + "</" + c.Kind + ">"
+}
+
+// collapse reduces runs of white space to single spaces.
+func collapse(s string) string {
+	collapsed := strings.Join(strings.Fields(s), " ")
+	if collapsed == "" {
+		if s == "" {
+			return ""
+		}
+		return " "
+	}
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		collapsed = " " + collapsed
+	}
+	if strings.TrimRight(s, " \t\r\n") != s {
+		collapsed += " "
+	}
+	return collapsed
+}
+
+// collapsed returns a copy of c with the white space in its text collapsed.
+func collapsed(c *Chunk) *Chunk {
+	n := newChunk(c.Kind)
+	for k, v := range c.Attributes {
+		n.Attributes[k] = v
+	}
+	n.references = c.references
+	if c.IsKind("TEXT") {
+		n.Attributes["TEXT"] = collapse(c.Attributes["TEXT"])
+	}
+	for _, ch := range c.Children {
+		n.AddChild(collapsed(ch))
+	}
+	return n
+}
@@ -3,30 +3,102 @@ package xmlTree
 import (
 	"encoding/xml"
 	"io"
+	"strconv"
 	"strings"
 )
 
-func tokens(data string) []xml.Token {
-	var output []xml.Token
-	decoder := xml.NewDecoder(strings.NewReader(data))
-	decoder.Strict = false
-	for {
-		token, err := decoder.Token()
-		if err != nil && err != io.EOF {
+// ParseError describes where a document stopped being well formed.
+type ParseError struct {
+	Line    int
+	Column  int
+	Context string
+	Msg     string
+}
+
+func (e *ParseError) Error() string {
+	output := "line " + strconv.Itoa(e.Line) + ", column " + strconv.Itoa(e.Column) + ": " + e.Msg
+	if strings.TrimSpace(e.Context) != "" {
+		output += "\n\t" + e.Context + "\n\t" + e.caret()
+	}
+	return output
+}
+
+// caret points at the column in Context, keeping any tabs so that it lines up.
+func (e *ParseError) caret() string {
+	var output string
+	for i, r := range []rune(e.Context) {
+		if i >= e.Column-1 {
 			break
 		}
-		if token == nil {
-			break
+		if r == '\t' {
+			output += "\t"
+		} else {
+			output += " "
 		}
+	}
+	return output + "^"
+}
 
-		output = append(output, xml.CopyToken(token))
+// newParseError locates offset in data, quoting the line it falls on.
+func newParseError(data string, offset int, err error) *ParseError {
+	if offset > len(data) {
+		offset = len(data)
 	}
-	return output
+	e := &ParseError{Msg: err.Error()}
+	if se, ok := err.(*xml.SyntaxError); ok {
+		e.Msg = se.Msg
+	}
+	start := strings.LastIndex(data[:offset], "\n") + 1
+	end := strings.Index(data[offset:], "\n")
+	if end < 0 {
+		end = len(data)
+	} else {
+		end += offset
+	}
+	e.Line = strings.Count(data[:start], "\n") + 1
+	e.Column = len([]rune(data[start:offset])) + 1
+	line := []rune(strings.TrimRight(data[start:end], "\r"))
+	// long lines are cut down to the part around the error
+	const width = 60
+	if e.Column-1 > width {
+		line = line[e.Column-1-width:]
+		e.Column = width + 1
+	}
+	if len(line) > 2*width {
+		line = line[:2*width]
+	}
+	e.Context = string(line)
+	return e
 }
 
+// New parses data, ignoring any error after the last complete token.
 func New(data string) Chunks {
+	output, _ := Parse(data)
+	return output
+}
+
+// Parse parses data, returning the chunks read before the first error.
+func Parse(data string) (Chunks, error) {
+	output, errs := parse(data, false)
+	if len(errs) > 0 {
+		return output, errs[0]
+	}
+	return output, nil
+}
+
+// ParseRecover parses data as libxml2's recover mode does: after each error the
+// offending markup is skipped and parsing resumes at the next tag, inside
+// whichever elements were open. Every error met along the way is returned.
+func ParseRecover(data string) (Chunks, []error) {
+	return parse(data, true)
+}
+
+func parse(data string, recover bool) (Chunks, []error) {
 	var output Chunks
+	var errs []error
 	var current *Chunk
+	// open holds the start tags of the open elements, as written in data
+	var open []string
 	stack := func(c *Chunk) {
 		if current == nil {
 			output = append(output, c)
@@ -34,24 +106,74 @@ func New(data string) Chunks {
 			current.AddChildren(Chunks{c})
 		}
 	}
-	for _, token := range tokens(data) {
-		switch element := token.(type) {
-		case xml.EndElement:
-			current = current.Parent
-		case xml.CharData:
-			stack(newTextChunk(string(element)))
-		case xml.StartElement:
-			c := newChunk(element.Name.Local)
-			for _, a := range element.Attr {
-				c.Attributes[a.Name.Local] = a.Value
+	offset := 0
+	for {
+		// a restarted decoder is given the open elements again, so that
+		// their end tags and namespaces are still understood
+		prefix := strings.Join(open, "")
+		decoder := xml.NewDecoder(strings.NewReader(prefix + data[offset:]))
+		decoder.Strict = false
+		decoder.CharsetReader = charsetReader
+		skip := len(open)
+		var err error
+		var start int
+		for {
+			start = offset + int(decoder.InputOffset()) - len(prefix)
+			var token xml.Token
+			token, err = decoder.Token()
+			if token == nil || err != nil {
+				break
+			}
+			if skip > 0 {
+				if _, ok := token.(xml.StartElement); ok {
+					skip--
+					continue
+				}
+			}
+			switch element := token.(type) {
+			case xml.EndElement:
+				if current != nil {
+					current = current.Parent
+					open = open[:len(open)-1]
+				}
+			case xml.CharData:
+				end := offset + int(decoder.InputOffset()) - len(prefix)
+				for _, c := range textChunks(data[start:end], string(element)) {
+					stack(c)
+				}
+			case xml.StartElement:
+				c := newChunk(element.Name.Local)
+				for _, a := range element.Attr {
+					c.Attributes[a.Name.Local] = a.Value
+				}
+				end := offset + int(decoder.InputOffset()) - len(prefix)
+				c.references = attributeReferences(data[start:end], c.Attributes)
+				stack(c)
+				current = c
+				open = append(open, data[start:end])
+			case xml.Directive:
+				stack(newDirectiveChunk(string(element)))
+			case xml.ProcInst:
+				stack(newProcessingInstructionChunk(element.Target, string(element.Inst)))
+			case xml.Comment:
+				stack(newCommentChunk(string(element)))
 			}
-			stack(c)
-			current = c
-		case xml.Directive:
-			stack(newDirectiveChunk(string(element)))
-		case xml.ProcInst:
-			stack(newProcessingInstructionChunk(element.Target, string(element.Inst)))
 		}
+		if err == nil || err == io.EOF {
+			break
+		}
+		if start < offset {
+			start = offset
+		}
+		errs = append(errs, newParseError(data, start, err))
+		if !recover || start+1 >= len(data) {
+			break
+		}
+		next := strings.Index(data[start+1:], "<")
+		if next < 0 {
+			break
+		}
+		offset = start + 1 + next
 	}
-	return output
+	return output, errs
 }
@@ -0,0 +1,126 @@
+package xmlTree
+
+import "testing"
+
+// element returns an element with attributes given as name, value pairs and
+// the given children.
+func element(kind string, attributes []string, children ...*Chunk) *Chunk {
+	c := newChunk(kind)
+	for i := 0; i+1 < len(attributes); i += 2 {
+		c.Attributes[attributes[i]] = attributes[i+1]
+	}
+	c.AddChildren(children)
+	return c
+}
+
+func TestXML(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *Chunk
+		want string
+	}{
+		{"empty element", element("xref", []string{"linkend", "a"}), `<xref linkend="a"/>`},
+		{"attribute order", element("x", []string{"b", "2", "a", "1", "c", "3"}), `<x a="1" b="2" c="3"/>`},
+		{"bookkeeping attributes", element("x", []string{"DIR", "en-US", "MESSAGE", "4", "id", "i"}), `<x id="i"/>`},
+		{"text escaping", element("p", nil, newTextChunk("a < b && c > d")), `<p>a &lt; b &amp;&amp; c &gt; d</p>`},
+		{"entity references", element("p", nil, newReferenceChunk("PRODUCT"), newTextChunk(" &PRODUCT; &#169;")), `<p>&PRODUCT; &amp;PRODUCT; &amp;#169;</p>`},
+		{"attribute escaping", element("x", []string{"a", "\"<&>\"\t\n"}), `<x a="&quot;&lt;&amp;&gt;&quot;&#x9;&#xA;"/>`},
+		{"comment and instruction", element("p", nil, newCommentChunk(" note "), newProcessingInstructionChunk("asciidoc-br", ""), newProcessingInstructionChunk("dbfo", "keep-together=\"auto\"")), `<p><!-- note --><?asciidoc-br?><?dbfo keep-together="auto"?></p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.XML(); got != tt.want {
+				t.Errorf("XML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReferences(t *testing.T) {
+	tests := map[string]string{
+		`<p>&PRODUCT; and &amp;PRODUCT;</p>`:          `<p>&PRODUCT; and &amp;PRODUCT;</p>`,
+		`<p>Write &amp;lt; for &lt;</p>`:              `<p>Write &amp;lt; for &lt;</p>`,
+		`<p>a &amp;#169; b &#169; &#xA9;</p>`:         `<p>a &amp;#169; b © ©</p>`,
+		"<p>&A;&B;\r\n&#38;C;</p>":                    "<p>&A;&B;\n&amp;C;</p>",
+		`<p><![CDATA[&PRODUCT;]]></p>`:                `<p>&amp;PRODUCT;</p>`,
+		`<x a="&amp;amp;" b='&URL;/&amp;URL; &lt;'/>`: `<x a="&amp;amp;" b="&URL;/&amp;URL; &lt;"/>`,
+	}
+	for in, want := range tests {
+		if got := New(in).XML(); got != want {
+			t.Errorf("New(%q).XML() = %q, want %q", in, got, want)
+		}
+	}
+	p := New(`<p>See &PRODUCT;.</p>`)[0]
+	if len(p.Children) != 3 || p.Children[1].Attributes["REFERENCE"] != "PRODUCT" || p.Children.Text() != "See &PRODUCT;." {
+		t.Errorf("the reference is not a chunk of its own: %q", p.Children.Text())
+	}
+	// a value changed since parsing keeps only the references still in it
+	x := New(`<x a="&URL;/path"/>`)[0]
+	x.Attributes["a"] = "&amp;"
+	if got := x.XML(); got != `<x a="&amp;amp;"/>` {
+		t.Errorf("XML() of a changed value = %q", got)
+	}
+}
+
+func TestXMLWithIndent(t *testing.T) {
+	book := Chunks{
+		newTextChunk("\n"),
+		element("authorgroup", nil,
+			newTextChunk("\n  "),
+			element("author", nil,
+				element("personname", nil, element("firstname", nil, newTextChunk("Ann")), element("surname", nil, newTextChunk("Lee"))),
+			),
+			newTextChunk("\n"),
+		),
+		element("legalnotice", nil,
+			element("para", nil, newTextChunk("\n\tSee  "), element("link", []string{"xlink:href", "https://example.com"}, newTextChunk("the\nsite")), newTextChunk(" now.\n")),
+		),
+	}
+	want := `<authorgroup>
+	<author>
+		<personname>
+			<firstname>Ann</firstname>
+			<surname>Lee</surname>
+		</personname>
+	</author>
+</authorgroup>
+<legalnotice>
+	<para>See <link xmlns:xlink="http://www.w3.org/1999/xlink" xlink:href="https://example.com">the site</link> now.</para>
+</legalnotice>`
+	got := book.XMLWith(XMLOptions{Indent: "\t", Namespaces: map[string]string{"xlink": "http://www.w3.org/1999/xlink"}})
+	if got != want {
+		t.Errorf("XMLWith() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestXMLNamespaces(t *testing.T) {
+	c := element("info", nil, element("link", []string{"xlink:href", "a"}), element("db:x", []string{"xlink:title", "t"}))
+	o := XMLOptions{Namespaces: map[string]string{"xlink": "X", "db": "D"}}
+	want := `<info><link xmlns:xlink="X" xlink:href="a"/><db:x xmlns:db="D" xmlns:xlink="X" xlink:title="t"/></info>`
+	if got := c.XMLWith(o); got != want {
+		t.Errorf("XMLWith() = %q, want %q", got, want)
+	}
+	// a prefix declared by an ancestor is not declared again
+	c = element("info", []string{"xlink:type", "simple"}, element("link", []string{"xlink:href", "a"}))
+	want = `<info xmlns:xlink="X" xlink:type="simple"><link xlink:href="a"/></info>`
+	if got := c.XMLWith(o); got != want {
+		t.Errorf("XMLWith() = %q, want %q", got, want)
+	}
+}
+
+func TestCollapse(t *testing.T) {
+	tests := map[string]string{
+		"":             "",
+		"   ":          " ",
+		"a  b":         "a b",
+		"\n a\tb \n":   " a b ",
+		"a\n\nb":       "a b",
+		" leading":     " leading",
+		"trailing\t\n": "trailing ",
+	}
+	for in, want := range tests {
+		if got := collapse(in); got != want {
+			t.Errorf("collapse(%q) = %q, want %q", in, got, want)
+		}
+	}
+}